@@ -0,0 +1,159 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+var fileMode os.FileMode
+
+// validateACLs checks -acl grants ("principal:rights", rights as icacls
+// takes them, e.g. CORP\consumers:RX) and parses -file-mode.
+func validateACLs() error {
+	if len(aclGrants) > 0 && runtime.GOOS != "windows" {
+		return fmt.Errorf("-acl needs Windows (icacls); use -file-mode on other platforms")
+	}
+	if aclSidecar && runtime.GOOS != "windows" {
+		return fmt.Errorf("-acl-sidecar needs Windows")
+	}
+	for _, g := range aclGrants {
+		if i := strings.LastIndexByte(g, ':'); i <= 0 || i == len(g)-1 {
+			return fmt.Errorf("invalid -acl %q (want principal:rights, e.g. CORP\\consumers:R)", g)
+		}
+	}
+	if fileModeSpec != "" {
+		m, err := strconv.ParseUint(fileModeSpec, 8, 32)
+		if err != nil || m > 0777 {
+			return fmt.Errorf("invalid -file-mode %q (want octal, e.g. 0444)", fileModeSpec)
+		}
+		fileMode = os.FileMode(m)
+	}
+	return nil
+}
+
+// applyACLs grants the -acl rights on a published file and sets -file-mode.
+func applyACLs(dest string) error {
+	if fileMode != 0 {
+		if err := os.Chmod(dest, fileMode); err != nil {
+			return err
+		}
+	}
+	if len(aclGrants) == 0 {
+		return nil
+	}
+	args := []string{dest}
+	for _, g := range aclGrants {
+		i := strings.LastIndexByte(g, ':')
+		rights := g[i+1:]
+		if !strings.HasPrefix(rights, "(") {
+			rights = "(" + rights + ")"
+		}
+		args = append(args, "/grant", g[:i]+":"+rights)
+	}
+	if output, err := commandCombinedOutput(exec.Command("icacls", args...)); err != nil {
+		return fmt.Errorf("icacls failed: %s\n%s", err, output)
+	}
+	return nil
+}
+
+// aclEntry is the archive entry -acl-sidecar stores the source files'
+// security descriptors in, as SDDL.
+const aclEntry = ".zipper-acls.json"
+
+type fileACL struct {
+	Name string `json:"name"`
+	SDDL string `json:"sddl"`
+}
+
+type aclsFile struct {
+	Files []fileACL `json:"files"`
+}
+
+func addACLEntry(zw *zip.Writer, files []sourceFile) error {
+	doc := aclsFile{Files: []fileACL{}}
+	for _, f := range files {
+		sddl, err := readSDDL(f.path)
+		if err != nil {
+			return fmt.Errorf("cannot read ACL of %s: %w", f.path, err)
+		}
+		doc.Files = append(doc.Files, fileACL{Name: filepath.ToSlash(f.name), SDDL: sddl})
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	w, err := zw.Create(aclEntry)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// runACL implements "zipper acl restore", which reapplies the ACLs an
+// -acl-sidecar archive recorded to the files extracted from it under -dir.
+func runACL(args []string) int {
+	if len(args) == 0 || args[0] != "restore" {
+		fmt.Fprintln(os.Stderr, "Usage: zipper acl restore [-dir DIR] [-owner] ARCHIVE.zip")
+		return 2
+	}
+	fs := flag.NewFlagSet("acl restore", flag.ExitOnError)
+	dir := fs.String("dir", ".", "Directory the zip was extracted into")
+	owner := fs.Bool("owner", false, "Restore owner and group too (needs SeRestorePrivilege, e.g. an elevated prompt)")
+	fs.Parse(args[1:])
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "❌ Please provide one archive")
+		return 2
+	}
+	if runtime.GOOS != "windows" {
+		fmt.Fprintln(os.Stderr, "❌ ACLs can only be restored on Windows")
+		return 1
+	}
+	zr, err := zip.OpenReader(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer zr.Close()
+	f, err := zr.Open(aclEntry)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s has no ACLs; was it made with -acl-sidecar?\n", fs.Arg(0))
+		return 1
+	}
+	var doc aclsFile
+	err = json.NewDecoder(f).Decode(&doc)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", aclEntry, err)
+		return 1
+	}
+
+	var restored, failed int
+	for _, a := range doc.Files {
+		if strings.HasPrefix(a.Name, "/") || strings.Contains("/"+a.Name+"/", "/../") {
+			fmt.Fprintf(os.Stderr, "⚠️  Skipping unsafe name %q\n", a.Name)
+			failed++
+			continue
+		}
+		if err := applySDDL(filepath.Join(*dir, filepath.FromSlash(a.Name)), a.SDDL, *owner); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  %s: %v\n", a.Name, err)
+			failed++
+			continue
+		}
+		restored++
+	}
+	fmt.Printf("✅ ACLs restored on %d files\n", restored)
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "❌ %d files could not be restored\n", failed)
+		return 1
+	}
+	return 0
+}
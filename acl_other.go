@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+var errNoSDDL = errors.New("Windows ACLs can only be read and restored on Windows")
+
+func readSDDL(path string) (string, error) {
+	return "", errNoSDDL
+}
+
+func applySDDL(path, sddl string, owner bool) error {
+	return errNoSDDL
+}
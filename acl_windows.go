@@ -0,0 +1,48 @@
+package main
+
+import "golang.org/x/sys/windows"
+
+// readSDDL returns the owner, group and DACL of path as SDDL.
+func readSDDL(path string) (string, error) {
+	sd, err := windows.GetNamedSecurityInfo(path, windows.SE_FILE_OBJECT,
+		windows.OWNER_SECURITY_INFORMATION|windows.GROUP_SECURITY_INFORMATION|windows.DACL_SECURITY_INFORMATION)
+	if err != nil {
+		return "", err
+	}
+	return sd.String(), nil
+}
+
+// applySDDL sets the DACL in sddl on path, and with owner its owner and
+// group. A DACL that inherited from its parent keeps doing so from the new
+// parent; its inherited entries are recomputed rather than copied.
+func applySDDL(path, sddl string, owner bool) error {
+	sd, err := windows.SecurityDescriptorFromString(sddl)
+	if err != nil {
+		return err
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return err
+	}
+	control, _, err := sd.Control()
+	if err != nil {
+		return err
+	}
+	info := windows.SECURITY_INFORMATION(windows.DACL_SECURITY_INFORMATION)
+	if control&windows.SE_DACL_PROTECTED != 0 {
+		info |= windows.PROTECTED_DACL_SECURITY_INFORMATION
+	} else {
+		info |= windows.UNPROTECTED_DACL_SECURITY_INFORMATION
+	}
+	var o, g *windows.SID
+	if owner {
+		if o, _, err = sd.Owner(); err != nil {
+			return err
+		}
+		if g, _, err = sd.Group(); err != nil {
+			return err
+		}
+		info |= windows.OWNER_SECURITY_INFORMATION | windows.GROUP_SECURITY_INFORMATION
+	}
+	return windows.SetNamedSecurityInfo(path, windows.SE_FILE_OBJECT, info, o, g, dacl, nil)
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// The archive attribute only exists on Windows file systems.
+func setArchiveAttr(path string) error {
+	fmt.Fprintf(os.Stderr, "⚠️  Archive attribute not supported on this platform, skipping %s\n", path)
+	return nil
+}
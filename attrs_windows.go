@@ -0,0 +1,15 @@
+package main
+
+import "golang.org/x/sys/windows"
+
+func setArchiveAttr(path string) error {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+	attrs, err := windows.GetFileAttributes(p)
+	if err != nil {
+		return err
+	}
+	return windows.SetFileAttributes(p, attrs|windows.FILE_ATTRIBUTE_ARCHIVE)
+}
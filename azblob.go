@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	azureMaxBlocks = 50000
+	azureVersion   = "2021-08-06"
+)
+
+// uploadAzureBlob uploads file as a block blob: blocks are staged with Put
+// Block and committed with Put Block List. Uncommitted blocks are kept by the
+// service for a week, which is what makes -resume work. The SAS token comes
+// from the target URL or, when set, the target credential's password.
+func uploadAzureBlob(dest, file, sas string, prog *stageProgress) error {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return err
+	}
+	if sas != "" {
+		u.RawQuery = strings.TrimPrefix(sas, "?")
+	}
+	u.Path = path.Join("/", u.Path, path.Base(strings.ReplaceAll(file, `\`, "/")))
+	blobURL := *u
+	blobURL.RawQuery = ""
+
+	size := fileSize(file)
+	ps := max(int64(partSize), (size+azureMaxBlocks-1)/azureMaxBlocks)
+	st, err := loadUploadState(file, blobURL.String(), ps)
+	if err != nil {
+		return err
+	}
+
+	err = uploadParts(st, file, prog, func(n int, r io.ReadSeeker, size int64) (string, error) {
+		// Block IDs must all have the same length.
+		id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%08d", n)))
+		q := u.Query()
+		q.Set("comp", "block")
+		q.Set("blockid", id)
+		return id, azureRequest(u, q, r, size)
+	})
+	if err != nil {
+		return err
+	}
+
+	var list strings.Builder
+	list.WriteString(`<?xml version="1.0" encoding="utf-8"?><BlockList>`)
+	for n := 1; n <= st.partCount(); n++ {
+		fmt.Fprintf(&list, "<Latest>%s</Latest>", st.Parts[n])
+	}
+	list.WriteString("</BlockList>")
+	q := u.Query()
+	q.Set("comp", "blocklist")
+	body := strings.NewReader(list.String())
+	if err := azureRequest(u, q, body, int64(body.Len())); err != nil {
+		return err
+	}
+	st.remove()
+	return nil
+}
+
+func azureRequest(u *url.URL, q url.Values, body io.Reader, size int64) error {
+	reqURL := *u
+	reqURL.RawQuery = q.Encode()
+	req, err := http.NewRequest(http.MethodPut, reqURL.String(), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("x-ms-version", azureVersion)
+	resp, err := httpClient.Do(req)
+	if ue, ok := err.(*url.Error); ok {
+		// Don't leak the SAS signature in the request URL.
+		err = ue.Err
+	}
+	if err != nil {
+		return fmt.Errorf("azure %s failed: %s", q.Get("comp"), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("azure %s failed: %s\n%s", q.Get("comp"), resp.Status, msg)
+	}
+	return nil
+}
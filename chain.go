@@ -0,0 +1,284 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// -chain writes <out>.chain.json, linking the source tree hash to the
+// archive hash, its signature and the upload locations, and signs it as a
+// unit. "zipper audit" checks every link of a shipped artifact against it.
+//
+// The tree hash is the SHA256 of the per-file list -file-hashes writes
+// ("<sha256>  <name>" per archived file, in archive order), so it can also be
+// checked with sha256sum <out>.files.sha256.
+
+type chain struct {
+	Version   int            `json:"version"`
+	Source    chainSource    `json:"source"`
+	Archive   chainArchive   `json:"archive"`
+	Signature chainSignature `json:"signature"`
+	Locations []string       `json:"locations,omitempty"`
+	Created   time.Time      `json:"created"`
+}
+
+type chainSource struct {
+	Path       string `json:"path"`
+	Files      int    `json:"files"`
+	SourceSize int64  `json:"source_size"`
+	TreeSHA256 string `json:"tree_sha256"`
+}
+
+type chainArchive struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type chainSignature struct {
+	File   string `json:"file"`
+	Signer string `json:"signer"`
+	KeyID  string `json:"key_id,omitempty"`
+	SHA256 string `json:"sha256"`
+}
+
+func validateChain() error {
+	if writeChain && (!writeHash || !gpgSign) {
+		return fmt.Errorf("-chain needs -hash and -sign")
+	}
+	return nil
+}
+
+func chainFile(zipPath string) string {
+	return zipPath + ".chain.json"
+}
+
+// chainSignatureFile is the signature "zipper audit" looks for next to the
+// chain: .asc for armored and clear-signed GPG, .sig otherwise.
+func chainSignatureFile(file string) string {
+	if signerName == "gpg" && signFormat != "binary" {
+		return file + ".asc"
+	}
+	return file + ".sig"
+}
+
+// writeChainFile writes and signs the chain for the artifact a, to be copied
+// to targets. It runs after the sign and IPFS steps.
+func writeChainFile(a *artifact, targets []target) error {
+	fillManifest(a.zip, a.hash)
+	m := artifactManifest
+	c := chain{
+		Version: 1,
+		Source:  chainSource{Path: a.src, Files: m.Files, SourceSize: m.SourceSize, TreeSHA256: m.TreeSHA256},
+		Archive: chainArchive{Name: m.Artifact, Size: m.Size, SHA256: m.SHA256},
+		Created: time.Now().UTC().Truncate(time.Second),
+	}
+	if len(m.Signatures) > 0 {
+		sig := m.Signatures[0]
+		sum, err := fileSHA256(filepath.Join(filepath.Dir(a.zip), sig.File), nil)
+		if err != nil {
+			return err
+		}
+		c.Signature = chainSignature{File: sig.File, Signer: sig.Signer, KeyID: sig.KeyID, SHA256: sum}
+	}
+	for _, t := range targets {
+		if isIPFS(t.Path) {
+			if m.IPFS != "" {
+				c.Locations = append(c.Locations, "ipfs://"+m.IPFS)
+			}
+			continue
+		}
+		c.Locations = append(c.Locations, targetLocation(t.Path, m.Artifact))
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := chainFile(a.zip)
+	if err := os.WriteFile(file, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	if signerName == "gpg" {
+		return signWithGpg(file)
+	}
+	sum := sha256.Sum256(append(data, '\n'))
+	var sig signature
+	return signWithService(&sig, file, hex.EncodeToString(sum[:]), chainSignatureFile(file))
+}
+
+// runAudit implements "zipper audit CHAIN.json": it checks the chain's own
+// signature, then each link it records, and prints one line per check.
+func runAudit(args []string) int {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	pubKey := fs.String("pubkey", "", "PEM public key to check KMS/PKCS#11 .sig signatures with (GPG uses the keyring)")
+	archive := fs.String("archive", "", "The archive to check (default: the one named in the chain, next to it)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: zipper audit [-pubkey KEY.pem] [-archive FILE] CHAIN.json")
+		return 2
+	}
+	file := fs.Arg(0)
+	var pub crypto.PublicKey
+	if *pubKey != "" {
+		var err error
+		if pub, err = loadPublicKey(*pubKey); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ -pubkey: %v\n", err)
+			return 2
+		}
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	var c chain
+	if err := json.Unmarshal(data, &c); err != nil || c.Version == 0 {
+		fmt.Fprintf(os.Stderr, "❌ %s is not a zipper chain file: %v\n", file, err)
+		return 1
+	}
+
+	failed := false
+	report := func(what string, res *checkResult) {
+		if res.OK {
+			fmt.Printf("✅ %s: %s\n", what, res.Detail)
+		} else {
+			fmt.Printf("❌ %s: %s\n", what, res.Detail)
+			failed = true
+		}
+	}
+	dir := filepath.Dir(file)
+	zipPath := *archive
+	if zipPath == "" {
+		zipPath = filepath.Join(dir, c.Archive.Name)
+	}
+
+	report("chain signature", checkChainSignature(file, data, c.Signature.Signer, pub))
+	report("source tree", checkTree(zipPath, c.Source))
+	archiveRes := checkFileHash(zipPath, c.Archive.Size, c.Archive.SHA256)
+	report("archive "+c.Archive.Name, archiveRes)
+	if c.Signature.File == "" {
+		report("signature", &checkResult{Detail: "the chain records no signature"})
+	} else {
+		sigPath := filepath.Join(filepath.Dir(zipPath), c.Signature.File)
+		res := checkFileHash(sigPath, -1, c.Signature.SHA256)
+		if res.OK && archiveRes.OK {
+			res = (&verifier{pub: pub}).checkSignature(sigPath, zipPath, c.Archive.SHA256)
+		}
+		report("signature "+c.Signature.File, res)
+	}
+	for _, loc := range c.Locations {
+		if strings.Contains(loc, "://") || (isUNC(loc) && runtime.GOOS != "windows") {
+			fmt.Printf("⚠️  %s: not checked (remote)\n", loc)
+			continue
+		}
+		report(loc, checkFileHash(loc, c.Archive.Size, c.Archive.SHA256))
+	}
+
+	if failed {
+		fmt.Println("❌ Chain verification failed")
+		return 1
+	}
+	fmt.Println("✅ Chain verified")
+	return 0
+}
+
+// checkChainSignature checks the .asc or .sig next to the chain file. A GPG
+// signed message must carry exactly the chain's content.
+func checkChainSignature(file string, data []byte, signer string, pub crypto.PublicKey) *checkResult {
+	sig := file + ".asc"
+	if _, err := os.Stat(sig); err != nil {
+		sig = file + ".sig"
+	}
+	if _, err := os.Stat(sig); err != nil {
+		return &checkResult{Detail: "no .asc or .sig next to the chain"}
+	}
+	if signer == "gpg" || strings.HasSuffix(sig, ".asc") {
+		signed, fpr, err := gpgVerify(sig, file)
+		if err != nil {
+			return &checkResult{Detail: err.Error()}
+		}
+		if !bytes.Equal(bytes.TrimSpace(signed), bytes.TrimSpace(data)) {
+			return &checkResult{Detail: "the signed content differs from the chain"}
+		}
+		return &checkResult{OK: true, Detail: "gpg " + fpr}
+	}
+	if pub == nil {
+		return &checkResult{Detail: "raw signature, but no -pubkey"}
+	}
+	raw, err := os.ReadFile(sig)
+	if err != nil {
+		return &checkResult{Detail: err.Error()}
+	}
+	sum := sha256.Sum256(data)
+	if err := verifyRaw(pub, sum[:], raw); err != nil {
+		return &checkResult{Detail: err.Error()}
+	}
+	return &checkResult{OK: true, Detail: "-pubkey"}
+}
+
+// checkFileHash checks file's size (unless size is -1) and SHA256.
+func checkFileHash(file string, size int64, sum string) *checkResult {
+	info, err := os.Stat(file)
+	if err != nil {
+		return &checkResult{Detail: err.Error()}
+	}
+	if size >= 0 && info.Size() != size {
+		return &checkResult{Detail: fmt.Sprintf("size %d, expected %d", info.Size(), size)}
+	}
+	actual, err := fileSHA256(file, nil)
+	if err != nil {
+		return &checkResult{Detail: err.Error()}
+	}
+	if !strings.EqualFold(actual, sum) {
+		return &checkResult{Detail: fmt.Sprintf("sha256 %s, expected %s", actual, sum)}
+	}
+	return &checkResult{OK: true, Detail: "sha256 " + actual}
+}
+
+// checkTree recomputes the tree hash from the archive's entries.
+func checkTree(zipPath string, src chainSource) *checkResult {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return &checkResult{Detail: err.Error()}
+	}
+	defer zr.Close()
+	tree := sha256.New()
+	files := 0
+	for _, f := range zr.File {
+		if f.Name == aclEntry || strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return &checkResult{Detail: fmt.Sprintf("%s: %v", f.Name, err)}
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, r)
+		r.Close()
+		if err != nil {
+			return &checkResult{Detail: fmt.Sprintf("%s: %v", f.Name, err)}
+		}
+		fmt.Fprintf(tree, "%s  %s\n", hex.EncodeToString(h.Sum(nil)), f.Name)
+		files++
+	}
+	if files != src.Files {
+		return &checkResult{Detail: fmt.Sprintf("%d files, expected %d", files, src.Files)}
+	}
+	if actual := hex.EncodeToString(tree.Sum(nil)); actual != src.TreeSHA256 {
+		return &checkResult{Detail: fmt.Sprintf("tree sha256 %s, expected %s", actual, src.TreeSHA256)}
+	}
+	return &checkResult{OK: true, Detail: fmt.Sprintf("%d files, tree sha256 %s", files, src.TreeSHA256)}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCheckTreeNestedNames checks that the tree hash written by a run matches
+// the one checkTree recomputes from the zip, for names with a separator. The
+// manifest lists them with forward slashes, so the zip entries must use them
+// too, whatever the OS separator.
+func TestCheckTreeNestedNames(t *testing.T) {
+	item := zipItem{file: sourceFile{name: filepath.Join("src", "dist", "app.js")}}
+	if got := item.header(0, 0).Name; got != "src/dist/app.js" {
+		t.Errorf("entry name %q, want src/dist/app.js", got)
+	}
+
+	work := t.TempDir()
+	src := filepath.Join(work, "src")
+	if err := expandFixture("testdata/basic.txt", src); err != nil {
+		t.Fatal(err)
+	}
+	// Files over readAheadMaxSize are compressed by zw.Create rather than
+	// ahead of time, and -first ones are stored, so every way of naming an
+	// entry is covered.
+	big := make([]byte, 2*readAheadMaxSize)
+	if err := os.WriteFile(filepath.Join(src, "dist", "assets", "big.bin"), big, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, flags := range [][]string{{"-manifest", "-file-hashes"}, {"-manifest", "-file-hashes", "-first", "dist/**"}} {
+		out := filepath.Join(work, "out.zip")
+		if _, err := goldenRun(src, work, "out.zip", flags); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(out + ".manifest.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatal(err)
+		}
+		if r := checkTree(out, chainSource{Files: m.Files, TreeSHA256: m.TreeSHA256}); !r.OK {
+			t.Errorf("%v: checkTree: %s", flags, r.Detail)
+		}
+	}
+}
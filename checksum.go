@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var bsdChecksumLine = regexp.MustCompile(`^SHA256 \((.+)\) = ([0-9a-fA-F]{64})$`)
+
+// runChecksum implements "zipper checksum verify", which checks files against
+// .sha256 sidecars or SHA256SUMS lists like "sha256sum -c". File names are
+// resolved relative to the directory of the checksum file. As with
+// sha256sum, a checksum file that verifies nothing is a failure.
+func runChecksum(args []string) int {
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, "Usage: zipper checksum verify [-quiet] [-ignore-missing] FILE.sha256|SHA256SUMS ...")
+		return 2
+	}
+	fs := flag.NewFlagSet("checksum verify", flag.ExitOnError)
+	quiet := fs.Bool("quiet", false, "Don't print OK for each successfully verified file")
+	ignoreMissing := fs.Bool("ignore-missing", false, "Don't fail or report status for missing files")
+	fs.Parse(args[1:])
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "❌ Please provide at least one checksum file")
+		return 2
+	}
+
+	var failed, unreadable, malformed, unverified int
+	for _, sumFile := range fs.Args() {
+		f, err := os.Open(sumFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			unreadable++
+			continue
+		}
+		dir := filepath.Dir(sumFile)
+		lines, checked := 0, 0
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			line := strings.TrimRight(sc.Text(), "\r")
+			if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			expected, name, ok := parseChecksumLine(line)
+			if !ok {
+				malformed++
+				continue
+			}
+			lines++
+
+			path := name
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, filepath.FromSlash(name))
+			}
+			actual, err := fileSHA256(path, nil)
+			if err == nil {
+				checked++
+			}
+			switch {
+			case err != nil && os.IsNotExist(err) && *ignoreMissing:
+			case err != nil:
+				fmt.Printf("%s: FAILED open or read\n", name)
+				unreadable++
+			case !strings.EqualFold(actual, expected):
+				fmt.Printf("%s: FAILED\n", name)
+				failed++
+			case !*quiet:
+				fmt.Printf("%s: OK\n", name)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", sumFile, err)
+			unreadable++
+		}
+		f.Close()
+		switch {
+		case sc.Err() != nil:
+		case lines == 0:
+			fmt.Fprintf(os.Stderr, "❌ %s: no properly formatted checksum lines found\n", sumFile)
+			unverified++
+		case checked == 0 && *ignoreMissing:
+			fmt.Fprintf(os.Stderr, "❌ %s: no file was verified\n", sumFile)
+			unverified++
+		}
+	}
+
+	if malformed > 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: %d line(s) are improperly formatted\n", malformed)
+	}
+	if unreadable > 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: %d listed file(s) could not be read\n", unreadable)
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: %d computed checksum(s) did NOT match\n", failed)
+	}
+	if failed+unreadable+malformed+unverified > 0 {
+		return 1
+	}
+	return 0
+}
+
+// parseChecksumLine accepts both the GNU ("<hash>  <name>", "<hash> *<name>")
+// and BSD ("SHA256 (<name>) = <hash>") formats.
+func parseChecksumLine(line string) (hash, name string, ok bool) {
+	if m := bsdChecksumLine.FindStringSubmatch(line); m != nil {
+		return m[2], m[1], true
+	}
+	if len(line) < 66 || line[64] != ' ' {
+		return "", "", false
+	}
+	hash = line[:64]
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", "", false
+	}
+	name = line[65:]
+	if strings.HasPrefix(name, "*") || strings.HasPrefix(name, " ") {
+		name = name[1:]
+	}
+	return hash, name, name != ""
+}
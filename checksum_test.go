@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecksumVerify(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	write("a.txt", "hello\n")
+	const helloSum = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+
+	for _, tt := range []struct {
+		name string
+		args []string
+		sums string
+		want int
+	}{
+		{"ok", nil, helloSum + "  a.txt\n", 0},
+		{"mismatch", nil, "0000000000000000000000000000000000000000000000000000000000000000  a.txt\n", 1},
+		{"empty", nil, "", 1},
+		{"no valid lines", nil, "# just a comment\nnot a checksum\n", 1},
+		{"all missing", []string{"-ignore-missing"}, helloSum + "  gone.txt\n", 1},
+		{"some missing", []string{"-ignore-missing"}, helloSum + "  a.txt\n" + helloSum + "  gone.txt\n", 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sums := write("SHA256SUMS", tt.sums)
+			args := append([]string{"verify", "-quiet"}, tt.args...)
+			if got := runChecksum(append(args, sums)); got != tt.want {
+				t.Errorf("exit code %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
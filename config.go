@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// config is the optional -config file. It lets one run publish to several
+// targets, each authenticating with its own named credential:
+//
+//	credentials:
+//	  deploy:
+//	    user: builder
+//	    domain: CORP
+//	    password: env:DEPLOY_PASS
+//	targets:
+//	  - path: \\deploy01\releases
+//	    credential: deploy
+//	    robocopy: true
+//	    verify: true
+//
+// Its jobs are run by "zipper run-all", see runAll.
+type config struct {
+	Credentials map[string]credential `yaml:"credentials"`
+	Targets     []target              `yaml:"targets"`
+	Jobs        []job                 `yaml:"jobs,omitempty"`
+}
+
+type credential struct {
+	User     string `yaml:"user"`
+	Domain   string `yaml:"domain"`   // for a user without one; default -domain
+	Password string `yaml:"password"` // literal or secret reference, see resolveSecret
+}
+
+type target struct {
+	Path       string `yaml:"path"`
+	Credential string `yaml:"credential"`
+	Robocopy   bool   `yaml:"robocopy"`
+	Verify     bool   `yaml:"verify"`
+}
+
+// job is one archive+publish run of "zipper run-all".
+type job struct {
+	Name    string   `yaml:"name"`
+	Src     string   `yaml:"src"`
+	Out     string   `yaml:"out"`
+	Flags   []string `yaml:"flags"`   // other zipper flags
+	Targets []target `yaml:"targets"` // published to with the config's credentials
+}
+
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateConfig(path, &root); err != nil {
+		return nil, err
+	}
+	var cfg config
+	if err := root.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// publishTargets returns the -copyto target, if any, followed by the
+// configured ones.
+func publishTargets(cfg *config) []target {
+	var targets []target
+	if copyTo != "" {
+		targets = append(targets, target{Path: copyTo, Robocopy: useRobocopy, Verify: verifyOnTarget})
+	}
+	if cfg != nil {
+		targets = append(targets, cfg.Targets...)
+	}
+	return targets
+}
+
+// targetCredentials resolves the user and password for t. Targets without a
+// named credential use -user and -pass. The user is qualified with the
+// credential's domain or -domain.
+func targetCredentials(cfg *config, t target) (string, string, error) {
+	if t.Credential == "" {
+		return qualifyUser(netUser, netDomain), netPass, nil
+	}
+	c := cfg.Credentials[t.Credential]
+	user, pass, err := resolveCredential(c)
+	if err != nil {
+		return "", "", fmt.Errorf("credential %q: %w", t.Credential, err)
+	}
+	domain := c.Domain
+	if domain == "" {
+		domain = netDomain
+	}
+	return qualifyUser(user, domain), pass, nil
+}
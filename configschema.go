@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The config is checked against this schema before it is decoded, so a typo
+// or a target that can't work is reported with its line up front rather
+// than halfway through a publish.
+
+type fieldKind int
+
+const (
+	kindString fieldKind = iota
+	kindBool
+	kindList // a sequence, its items checked by the caller
+)
+
+var (
+	configFields     = []string{"credentials", "jobs", "targets"}
+	credentialFields = map[string]fieldKind{"user": kindString, "domain": kindString, "password": kindString}
+	targetFields     = map[string]fieldKind{"path": kindString, "credential": kindString, "robocopy": kindBool, "verify": kindBool}
+	jobFields        = map[string]fieldKind{"name": kindString, "src": kindString, "out": kindString, "flags": kindList, "targets": kindList}
+)
+
+// configErrors lists every problem found in a config file.
+type configErrors []string
+
+func (e configErrors) Error() string {
+	if len(e) == 1 {
+		return e[0]
+	}
+	return fmt.Sprintf("%d problems:\n  %s", len(e), strings.Join(e, "\n  "))
+}
+
+type configChecker struct {
+	file     string
+	problems []configProblem
+}
+
+type configProblem struct {
+	line, col int
+	msg       string
+}
+
+func (c *configChecker) errorf(n *yaml.Node, field, format string, args ...any) {
+	c.problems = append(c.problems, configProblem{n.Line, n.Column, field + ": " + fmt.Sprintf(format, args...)})
+}
+
+// err returns the problems found, in file order.
+func (c *configChecker) err() error {
+	if len(c.problems) == 0 {
+		return nil
+	}
+	slices.SortStableFunc(c.problems, func(a, b configProblem) int {
+		if a.line != b.line {
+			return a.line - b.line
+		}
+		return a.col - b.col
+	})
+	var errs configErrors
+	for _, p := range c.problems {
+		errs = append(errs, fmt.Sprintf("%s:%d:%d: %s", c.file, p.line, p.col, p.msg))
+	}
+	return errs
+}
+
+// validateConfig checks the parsed document root of config file.
+func validateConfig(file string, root *yaml.Node) error {
+	c := &configChecker{file: file}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nil // empty file
+	}
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		c.errorf(doc, "config", "want a mapping with credentials, targets and jobs")
+		return c.err()
+	}
+
+	credentials := map[string]bool{}
+	var targets, jobs *yaml.Node
+	for key, val := range mappingPairs(doc) {
+		switch key.Value {
+		case "credentials":
+			if val.Kind != yaml.MappingNode {
+				c.errorf(val, "credentials", "want a mapping of credential names")
+				continue
+			}
+			for name, cred := range mappingPairs(val) {
+				credentials[name.Value] = true
+				c.checkCredential("credentials."+name.Value, cred)
+			}
+		case "targets":
+			targets = val
+		case "jobs":
+			jobs = val
+		default:
+			c.unknownField(key, key.Value, configFields)
+		}
+	}
+	if targets != nil {
+		if targets.Kind != yaml.SequenceNode {
+			c.errorf(targets, "targets", "want a list of targets")
+		} else {
+			for i, t := range targets.Content {
+				c.checkTarget(fmt.Sprintf("targets[%d]", i), t, credentials)
+			}
+		}
+	}
+	if jobs != nil {
+		if jobs.Kind != yaml.SequenceNode {
+			c.errorf(jobs, "jobs", "want a list of jobs")
+		} else {
+			names := map[string]bool{}
+			for i, j := range jobs.Content {
+				c.checkJob(fmt.Sprintf("jobs[%d]", i), j, credentials, names)
+			}
+		}
+	}
+	return c.err()
+}
+
+// mappingPairs yields the keys and values of mapping node n.
+func mappingPairs(n *yaml.Node) func(yield func(key, val *yaml.Node) bool) {
+	return func(yield func(key, val *yaml.Node) bool) {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if !yield(n.Content[i], n.Content[i+1]) {
+				return
+			}
+		}
+	}
+}
+
+// checkFields checks n's keys and value types against fields and returns
+// the scalar values by key.
+func (c *configChecker) checkFields(where string, n *yaml.Node, fields map[string]fieldKind) map[string]*yaml.Node {
+	values := map[string]*yaml.Node{}
+	if n.Kind != yaml.MappingNode {
+		c.errorf(n, where, "want a mapping of %s", strings.Join(slices.Sorted(maps.Keys(fields)), ", "))
+		return values
+	}
+	for key, val := range mappingPairs(n) {
+		kind, ok := fields[key.Value]
+		field := where + "." + key.Value
+		switch {
+		case !ok:
+			c.unknownField(key, field, slices.Sorted(maps.Keys(fields)))
+		case kind == kindList && val.Kind != yaml.SequenceNode:
+			c.errorf(val, field, "want a list")
+		case kind == kindList:
+			values[key.Value] = val
+		case val.Kind != yaml.ScalarNode:
+			c.errorf(val, field, "want a single value")
+		case kind == kindBool && val.Tag != "!!bool":
+			c.errorf(val, field, "want true or false, got %q", val.Value)
+		default:
+			values[key.Value] = val
+		}
+	}
+	return values
+}
+
+func (c *configChecker) unknownField(key *yaml.Node, field string, known []string) {
+	for _, k := range known {
+		if editDistance(key.Value, k) <= 2 {
+			c.errorf(key, field, "unknown field (did you mean %s?)", k)
+			return
+		}
+	}
+	c.errorf(key, field, "unknown field (want %s)", strings.Join(known, ", "))
+}
+
+func (c *configChecker) checkCredential(where string, n *yaml.Node) {
+	values := c.checkFields(where, n, credentialFields)
+	if v := values["password"]; v != nil {
+		if problem := secretRefProblem(v.Value); problem != "" {
+			c.errorf(v, where+".password", "%s", problem)
+		}
+	}
+}
+
+func (c *configChecker) checkTarget(where string, n *yaml.Node, credentials map[string]bool) {
+	values := c.checkFields(where, n, targetFields)
+	if n.Kind != yaml.MappingNode {
+		return
+	}
+	p := values["path"]
+	if p == nil || p.Value == "" {
+		c.errorf(n, where, "path is required")
+	} else if problem := targetPathProblem(p.Value); problem != "" {
+		c.errorf(p, where+".path", "%s", problem)
+	}
+	if v := values["credential"]; v != nil && v.Value != "" && !credentials[v.Value] {
+		c.errorf(v, where+".credential", "unknown credential %q", v.Value)
+	}
+	if v := values["robocopy"]; v != nil && v.Value == "true" && p != nil &&
+		(isCloudTarget(p.Value) || isSSH(p.Value) || isIPFS(p.Value) || isNFSURL(p.Value)) {
+		c.errorf(v, where+".robocopy", "robocopy only copies to UNC and local paths")
+	}
+}
+
+// checkJob checks a run-all job. names collects the job names seen so far.
+func (c *configChecker) checkJob(where string, n *yaml.Node, credentials, names map[string]bool) {
+	values := c.checkFields(where, n, jobFields)
+	if n.Kind != yaml.MappingNode {
+		return
+	}
+	if v := values["name"]; v == nil || v.Value == "" {
+		c.errorf(n, where, "name is required")
+	} else if names[v.Value] {
+		c.errorf(v, where+".name", "duplicate job name %q", v.Value)
+	} else {
+		names[v.Value] = true
+	}
+	for _, field := range []string{"src", "out"} {
+		if v := values[field]; v == nil || v.Value == "" {
+			c.errorf(n, where, "%s is required", field)
+		}
+	}
+	if flags := values["flags"]; flags != nil {
+		for i, f := range flags.Content {
+			field := fmt.Sprintf("%s.flags[%d]", where, i)
+			if f.Kind != yaml.ScalarNode {
+				c.errorf(f, field, "want a single value")
+				continue
+			}
+			name, _, _ := strings.Cut(strings.TrimLeft(f.Value, "-"), "=")
+			if strings.HasPrefix(f.Value, "-") && (name == "src" || name == "out" || name == "config") {
+				c.errorf(f, field, "-%s is set by run-all; use the job's src, out and targets", name)
+			}
+		}
+	}
+	if targets := values["targets"]; targets != nil {
+		for i, t := range targets.Content {
+			c.checkTarget(fmt.Sprintf("%s.targets[%d]", where, i), t, credentials)
+		}
+	}
+}
+
+// targetPathProblem describes what is wrong with target path p, if anything.
+func targetPathProblem(p string) string {
+	switch {
+	case strings.HasPrefix(p, "s3://"), strings.HasPrefix(p, "gs://"):
+		if bucket, _ := splitBucket(p); bucket == "" {
+			return fmt.Sprintf("%q has no bucket (want %s://bucket/prefix)", p, p[:2])
+		}
+	case isSSH(p):
+		if _, err := parseSSHTarget(p); err != nil {
+			return err.Error()
+		}
+	case isNFSURL(p):
+		if u, err := url.Parse(p); err != nil || u.Host == "" {
+			return fmt.Sprintf("invalid NFS URL %q (want nfs://server/export/path)", p)
+		}
+	case strings.HasPrefix(p, "gdrive://"):
+		if strings.Trim(strings.TrimPrefix(p, "gdrive://"), "/") == "" {
+			return fmt.Sprintf("%q has no folder (want gdrive://<folder ID>)", p)
+		}
+	case isGraph(p):
+		if _, rest, _ := strings.Cut(p, "://"); strings.Trim(rest, "/") == "" {
+			return fmt.Sprintf("%q has no drive (want onedrive://me/folder or sharepoint://host/sites/...)", p)
+		}
+	case isDropbox(p), isIPFS(p), isAzureBlob(p):
+	case isUNC(p):
+		parts := strings.FieldsFunc(p, func(r rune) bool { return r == '\\' || r == '/' })
+		if len(parts) < 2 {
+			return fmt.Sprintf("invalid UNC path %q (want \\\\server\\share\\path)", p)
+		}
+	case strings.Contains(p, "://"):
+		return fmt.Sprintf("unsupported target %q (want a UNC or local path, s3://, gs://, gdrive://, dropbox://, onedrive://, sharepoint://, an Azure blob URL, sftp://, scp://, nfs:// or ipfs://)", p)
+	}
+	return ""
+}
+
+// secretRefProblem describes what is wrong with secret reference ref, if
+// anything. Values without a known scheme are literals and always fine.
+func secretRefProblem(ref string) string {
+	scheme, rest, ok := strings.Cut(ref, ":")
+	if !ok {
+		return ""
+	}
+	switch scheme {
+	case "env", "keyring", "credman":
+		if rest == "" {
+			return fmt.Sprintf("%s: reference has no name", scheme)
+		}
+	case "dpapi":
+		if _, err := base64.StdEncoding.DecodeString(rest); err != nil || rest == "" {
+			return "dpapi: value is not base64 (see \"zipper dpapi protect\")"
+		}
+	case "vault":
+		if _, field, ok := strings.Cut(rest, "#"); !ok || field == "" {
+			return "vault: reference has no #field (want vault:<path>#<field>)"
+		}
+	}
+	return ""
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
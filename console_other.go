@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// setupConsole falls back to the plain progress bar on a dumb terminal.
+func setupConsole() {
+	if os.Getenv("TERM") == "dumb" {
+		consoleVT = false
+	}
+}
+
+// consoleText returns the output of a console program as is; it is UTF-8
+// wherever the locale is.
+func consoleText(b []byte) []byte {
+	return b
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/sys/windows"
+)
+
+const cpOEM = 1 // CP_OEMCP
+
+// setupConsole turns on virtual terminal processing for a console on stdout
+// and stderr. Consoles that refuse it (before Windows 10, or in legacy mode
+// as on some Server Core images) get the plain progress bar.
+func setupConsole() {
+	for _, f := range []*os.File{os.Stdout, os.Stderr} {
+		h := windows.Handle(f.Fd())
+		var mode uint32
+		if windows.GetConsoleMode(h, &mode) != nil {
+			continue // redirected
+		}
+		if mode&windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING == 0 &&
+			windows.SetConsoleMode(h, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) != nil && f == os.Stderr {
+			consoleVT = false
+		}
+	}
+}
+
+// consoleText converts the output of a console program to UTF-8. Programs
+// like robocopy, icacls and net write localized messages in the console's
+// output code page (the OEM code page without a console); output that is
+// already valid UTF-8 is returned as is.
+func consoleText(b []byte) []byte {
+	if len(b) == 0 || utf8.Valid(b) {
+		return b
+	}
+	cp, err := windows.GetConsoleOutputCP()
+	if err != nil || cp == 0 {
+		cp = cpOEM
+	}
+	n, err := windows.MultiByteToWideChar(cp, 0, &b[0], int32(len(b)), nil, 0)
+	if err != nil || n == 0 {
+		return b
+	}
+	w := make([]uint16, n)
+	if _, err := windows.MultiByteToWideChar(cp, 0, &b[0], int32(len(b)), &w[0], n); err != nil {
+		return b
+	}
+	return []byte(string(utf16.Decode(w)))
+}
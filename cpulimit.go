@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// paceFraction is the share of wall time the compressor may be busy; 1 means
+// no pacing.
+var paceFraction = 1.0
+
+// applyMaxCPU limits GOMAXPROCS and the reader count to the configured share
+// of cores. When the share isn't a whole number of cores, CPU-bound writers
+// are additionally paced with sleeps.
+func applyMaxCPU(spec string) error {
+	pct, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(spec), "%"), 64)
+	if err != nil || pct <= 0 || pct > 100 {
+		return fmt.Errorf("invalid -max-cpu %q (want a percentage like 50%%)", spec)
+	}
+	cores := float64(runtime.NumCPU()) * pct / 100
+	procs := max(int(math.Ceil(cores)), 1)
+	runtime.GOMAXPROCS(procs)
+	prefetchWorkers = min(prefetchWorkers, procs)
+	paceFraction = min(cores/float64(procs), 1)
+	return nil
+}
+
+type pacedWriter struct {
+	w    io.Writer
+	busy time.Duration
+}
+
+func pace(w io.Writer) io.Writer {
+	if paceFraction >= 1 {
+		return w
+	}
+	return &pacedWriter{w: w}
+}
+
+func (p *pacedWriter) Write(b []byte) (int, error) {
+	start := time.Now()
+	n, err := p.w.Write(b)
+	paceBusy(&p.busy, time.Since(start))
+	return n, err
+}
+
+// paceBusy adds d of CPU-bound work to busy and, once 50ms have built up,
+// sleeps long enough to keep that work at paceFraction of wall time.
+func paceBusy(busy *time.Duration, d time.Duration) {
+	if paceFraction >= 1 {
+		return
+	}
+	*busy += d
+	if *busy >= 50*time.Millisecond {
+		time.Sleep(time.Duration(float64(*busy) * (1/paceFraction - 1)))
+		*busy = 0
+	}
+}
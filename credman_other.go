@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+func credmanRead(target string) (string, string, error) {
+	return "", "", errors.New("credman: the Windows Credential Manager is only available on Windows")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modadvapi32  = windows.NewLazySystemDLL("advapi32.dll")
+	procCredRead = modadvapi32.NewProc("CredReadW")
+	procCredFree = modadvapi32.NewProc("CredFree")
+)
+
+const credTypeGeneric = 1
+
+// credentialW mirrors CREDENTIALW from wincred.h.
+type credentialW struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// credmanRead reads a generic credential (as stored by "cmdkey /generic:")
+// from the Windows Credential Manager.
+func credmanRead(target string) (string, string, error) {
+	name, err := windows.UTF16PtrFromString(target)
+	if err != nil {
+		return "", "", err
+	}
+	var cred *credentialW
+	r, _, err := procCredRead.Call(uintptr(unsafe.Pointer(name)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if r == 0 {
+		return "", "", fmt.Errorf("credential manager lookup of %s failed: %w", target, err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	user := windows.UTF16PtrToString(cred.UserName)
+	blob := unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)
+	if len(blob)%2 != 0 {
+		return user, string(blob), nil
+	}
+	u := make([]uint16, len(blob)/2)
+	for i := range u {
+		u[i] = uint16(blob[2*i]) | uint16(blob[2*i+1])<<8
+	}
+	return user, string(utf16.Decode(u)), nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import "strings"
+
+// dfsReferral is one storage target of a DFS link.
+type dfsReferral struct {
+	Server, Share string
+	Active        bool // the referral this client currently uses
+	Online        bool
+}
+
+// dfsTargets resolves a DFS namespace path such as \\corp\dfs\releases to the
+// physical paths behind it, the client's active referral first and offline
+// ones left out, so a copy can fail over between replicas. Other paths, or
+// when resolution fails, come back unchanged.
+func dfsTargets(p string) []string {
+	if !isUNC(p) {
+		return []string{p}
+	}
+	entry, refs, err := dfsResolve(strings.ReplaceAll(p, "/", `\`))
+	if err != nil {
+		return []string{p}
+	}
+	// The link may be a prefix of p; keep the part below it.
+	sep := func(r rune) bool { return r == '\\' || r == '/' }
+	parts := strings.FieldsFunc(p, sep)
+	rest := parts[min(len(strings.FieldsFunc(entry, sep)), len(parts)):]
+
+	var active, online []string
+	for _, r := range refs {
+		target := strings.Join(append([]string{`\\` + r.Server, r.Share}, rest...), `\`)
+		switch {
+		case r.Active:
+			active = append(active, target)
+		case r.Online:
+			online = append(online, target)
+		}
+	}
+	if targets := append(active, online...); len(targets) > 0 {
+		return targets
+	}
+	return []string{p}
+}
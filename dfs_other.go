@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+func dfsResolve(p string) (string, []dfsReferral, error) {
+	return "", nil, errors.New("dfs: namespace resolution is only available on Windows")
+}
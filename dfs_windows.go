@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modnetapi32             = windows.NewLazySystemDLL("netapi32.dll")
+	procNetDfsGetClientInfo = modnetapi32.NewProc("NetDfsGetClientInfo")
+	procNetApiBufferFree    = modnetapi32.NewProc("NetApiBufferFree")
+)
+
+const (
+	dfsStorageStateOnline = 2
+	dfsStorageStateActive = 4
+)
+
+// dfsInfo3 mirrors DFS_INFO_3 from lmdfs.h.
+type dfsInfo3 struct {
+	EntryPath        *uint16
+	Comment          *uint16
+	State            uint32
+	NumberOfStorages uint32
+	Storage          *dfsStorageInfo
+}
+
+// dfsStorageInfo mirrors DFS_STORAGE_INFO.
+type dfsStorageInfo struct {
+	State      uint32
+	ServerName *uint16
+	ShareName  *uint16
+}
+
+// dfsResolve asks the DFS client for the link containing p and its storage
+// targets. It returns the link's entry path.
+func dfsResolve(p string) (string, []dfsReferral, error) {
+	path, err := windows.UTF16PtrFromString(p)
+	if err != nil {
+		return "", nil, err
+	}
+	var info *dfsInfo3
+	r, _, _ := procNetDfsGetClientInfo.Call(uintptr(unsafe.Pointer(path)), 0, 0, 3, uintptr(unsafe.Pointer(&info)))
+	if r != 0 {
+		return "", nil, fmt.Errorf("NetDfsGetClientInfo %s: %w", p, syscall.Errno(r))
+	}
+	defer procNetApiBufferFree.Call(uintptr(unsafe.Pointer(info)))
+
+	var refs []dfsReferral
+	for _, s := range unsafe.Slice(info.Storage, info.NumberOfStorages) {
+		refs = append(refs, dfsReferral{
+			Server: windows.UTF16PtrToString(s.ServerName),
+			Share:  windows.UTF16PtrToString(s.ShareName),
+			Active: s.State&dfsStorageStateActive != 0,
+			Online: s.State&dfsStorageStateOnline != 0,
+		})
+	}
+	return windows.UTF16PtrToString(info.EntryPath), refs, nil
+}
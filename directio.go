@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io"
+	"os"
+	"unsafe"
+)
+
+// Unbuffered I/O (-direct-io) needs block-aligned buffers, offsets and
+// lengths. 4 KiB covers the sector size of current disks.
+const (
+	directIOAlign  = 4096
+	directIOBuffer = 1 << 20
+)
+
+func alignedBuffer(size int) []byte {
+	b := make([]byte, size+directIOAlign)
+	off := int(uintptr(unsafe.Pointer(&b[0])) & (directIOAlign - 1))
+	if off != 0 {
+		off = directIOAlign - off
+	}
+	return b[off : off+size]
+}
+
+// alignedReader reads r in aligned blocks and serves arbitrary-sized reads
+// from them.
+type alignedReader struct {
+	r   io.ReadCloser
+	buf []byte
+	pos int
+	n   int
+	err error
+}
+
+func (a *alignedReader) Read(p []byte) (int, error) {
+	for a.pos == a.n {
+		if a.err != nil {
+			return 0, a.err
+		}
+		a.n, a.err = a.r.Read(a.buf)
+		a.pos = 0
+	}
+	n := copy(p, a.buf[a.pos:a.n])
+	a.pos += n
+	return n, nil
+}
+
+func (a *alignedReader) Close() error {
+	return a.r.Close()
+}
+
+func openDirectSource(path string) (io.ReadCloser, error) {
+	r, err := openRetryReader(path, openDirectRead)
+	if err != nil {
+		return nil, err
+	}
+	return &alignedReader{r: r, buf: alignedBuffer(directIOBuffer)}, nil
+}
+
+// directWriter writes aligned blocks through an unbuffered handle. The
+// unaligned tail is appended through a regular handle on Close.
+type directWriter struct {
+	f      *os.File
+	path   string
+	buf    []byte
+	n      int
+	closed bool
+}
+
+func createDirect(path string) (*directWriter, error) {
+	f, err := createDirectFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &directWriter{f: f, path: path, buf: alignedBuffer(directIOBuffer)}, nil
+}
+
+func (w *directWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		c := copy(w.buf[w.n:], p)
+		w.n += c
+		written += c
+		p = p[c:]
+		if w.n == len(w.buf) {
+			if _, err := w.f.Write(w.buf); err != nil {
+				return written, err
+			}
+			w.n = 0
+		}
+	}
+	return written, nil
+}
+
+func (w *directWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	full := w.n &^ (directIOAlign - 1)
+	if full > 0 {
+		if _, err := w.f.Write(w.buf[:full]); err != nil {
+			w.f.Close()
+			return err
+		}
+	}
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	if full == w.n {
+		return nil
+	}
+
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(w.buf[full:w.n]); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
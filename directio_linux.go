@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Filesystems without O_DIRECT support (tmpfs, some FUSE mounts) reject it
+// with EINVAL; those fall back to regular I/O.
+
+func openDirectRead(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|unix.O_DIRECT, 0)
+	if errors.Is(err, unix.EINVAL) {
+		return os.Open(path)
+	}
+	return f, err
+}
+
+func createDirectFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|unix.O_DIRECT, 0644)
+	if errors.Is(err, unix.EINVAL) {
+		return os.Create(path)
+	}
+	return f, err
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+import "os"
+
+func openDirectRead(path string) (*os.File, error) {
+	return os.Open(path)
+}
+
+func createDirectFile(path string) (*os.File, error) {
+	return os.Create(path)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// freeCheckInterval is how much is written between free space checks. It
+// bounds how far below -min-free the volume can get.
+const freeCheckInterval = 8 << 20
+
+var errLowDiskSpace = errors.New("output volume is low on space")
+
+// freeSpaceGuard fails writes once the free space on the output volume drops
+// below -min-free, so the zip is abandoned before the volume fills up.
+type freeSpaceGuard struct {
+	io.WriteCloser
+	dir     string
+	pending int64 // written since the last check
+	off     bool  // free space can't be read here
+}
+
+func guardFreeSpace(w io.WriteCloser, out string) io.WriteCloser {
+	if minFree <= 0 {
+		return w
+	}
+	return &freeSpaceGuard{WriteCloser: w, dir: filepath.Dir(out), pending: freeCheckInterval}
+}
+
+func (g *freeSpaceGuard) Write(p []byte) (int, error) {
+	g.pending += int64(len(p))
+	if g.pending >= freeCheckInterval && !g.off {
+		g.pending = 0
+		free, err := diskFree(g.dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Cannot check free space on %s, -min-free is ignored: %v\n", g.dir, err)
+			g.off = true
+		} else if free-int64(len(p)) < int64(minFree) {
+			return 0, fmt.Errorf("%w: %s free on %s, -min-free is %s", errLowDiskSpace, formatSize(free), g.dir, minFree.String())
+		}
+	}
+	return g.WriteCloser.Write(p)
+}
@@ -0,0 +1,17 @@
+package main
+
+import "golang.org/x/sys/windows"
+
+// diskFree returns the bytes available to this user on dir's volume, taking
+// quotas into account.
+func diskFree(dir string) (int64, error) {
+	p, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var avail, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &avail, &total, &free); err != nil {
+		return 0, err
+	}
+	return int64(avail), nil
+}
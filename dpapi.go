@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runDPAPI implements "zipper dpapi protect", which reads a secret from stdin
+// and prints a dpapi: reference to paste into the config file.
+func runDPAPI(args []string) int {
+	if len(args) == 0 || args[0] != "protect" {
+		fmt.Fprintln(os.Stderr, "Usage: zipper dpapi protect [-scope user|machine] < secret.txt")
+		return 2
+	}
+	fs := flag.NewFlagSet("dpapi protect", flag.ExitOnError)
+	scope := fs.String("scope", "machine", "machine: any account on this machine can decrypt; user: only the current user")
+	fs.Parse(args[1:])
+	if *scope != "machine" && *scope != "user" {
+		fmt.Fprintf(os.Stderr, "❌ invalid -scope %q (want machine or user)\n", *scope)
+		return 2
+	}
+
+	secret, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	secret = strings.TrimRight(secret, "\r\n")
+	if secret == "" {
+		fmt.Fprintf(os.Stderr, "❌ No secret on stdin: %v\n", err)
+		return 1
+	}
+	enc, err := dpapiProtect([]byte(secret), *scope == "machine")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	fmt.Println("dpapi:" + enc)
+	return 0
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+var errNoDPAPI = errors.New("dpapi: DPAPI encrypted secrets are only available on Windows")
+
+func dpapiProtect(plain []byte, machine bool) (string, error) {
+	return "", errNoDPAPI
+}
+
+func dpapiUnprotect(b64 string) (string, error) {
+	return "", errNoDPAPI
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+func dpapiProtect(plain []byte, machine bool) (string, error) {
+	if len(plain) == 0 {
+		return "", fmt.Errorf("nothing to encrypt")
+	}
+	flags := uint32(windows.CRYPTPROTECT_UI_FORBIDDEN)
+	if machine {
+		flags |= windows.CRYPTPROTECT_LOCAL_MACHINE
+	}
+	in := windows.DataBlob{Size: uint32(len(plain)), Data: &plain[0]}
+	var out windows.DataBlob
+	if err := windows.CryptProtectData(&in, nil, nil, 0, nil, flags, &out); err != nil {
+		return "", fmt.Errorf("CryptProtectData: %w", err)
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	return base64.StdEncoding.EncodeToString(unsafe.Slice(out.Data, out.Size)), nil
+}
+
+// dpapiUnprotect decrypts a value produced by "zipper dpapi protect". Machine
+// scope values decrypt for any account on the machine that encrypted them,
+// user scope values only for the same user.
+func dpapiUnprotect(b64 string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil || len(data) == 0 {
+		return "", fmt.Errorf("dpapi: invalid base64 value")
+	}
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return "", fmt.Errorf("dpapi: cannot decrypt (encrypted on another machine or for another user?): %w", err)
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	return string(unsafe.Slice(out.Data, out.Size)), nil
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Dropbox targets are written dropbox://folder/path. The access token is the
+// target credential's password or DROPBOX_TOKEN; with DROPBOX_REFRESH_TOKEN
+// and DROPBOX_APP_KEY (and DROPBOX_APP_SECRET for confidential apps) a
+// short-lived token is fetched instead.
+
+var (
+	dropboxAPI     = "https://api.dropboxapi.com"
+	dropboxContent = "https://content.dropboxapi.com"
+)
+
+const (
+	// Dropbox hashes content in 4 MiB blocks; upload chunks must be
+	// multiples of it and at most 150 MiB.
+	dropboxBlockSize = 4 << 20
+	dropboxMaxChunk  = 148 << 20
+)
+
+func isDropbox(p string) bool {
+	return strings.HasPrefix(p, "dropbox://")
+}
+
+func dropboxPath(dest, name string) string {
+	return path.Join("/", strings.TrimPrefix(dest, "dropbox://"), name)
+}
+
+func dropboxToken(explicit string) (string, error) {
+	if explicit != "" {
+		return explicit, nil
+	}
+	if refresh := os.Getenv("DROPBOX_REFRESH_TOKEN"); refresh != "" {
+		form := url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refresh},
+			"client_id":     {os.Getenv("DROPBOX_APP_KEY")},
+		}
+		if secret := os.Getenv("DROPBOX_APP_SECRET"); secret != "" {
+			form.Set("client_secret", secret)
+		}
+		resp, err := httpClient.PostForm(dropboxAPI+"/oauth2/token", form)
+		if err != nil {
+			return "", fmt.Errorf("dropbox token: %w", err)
+		}
+		defer resp.Body.Close()
+		var tok struct {
+			AccessToken string `json:"access_token"`
+		}
+		json.NewDecoder(resp.Body).Decode(&tok)
+		if resp.StatusCode != http.StatusOK || tok.AccessToken == "" {
+			return "", fmt.Errorf("dropbox token failed: %s", resp.Status)
+		}
+		return tok.AccessToken, nil
+	}
+	if t := os.Getenv("DROPBOX_TOKEN"); t != "" {
+		return t, nil
+	}
+	return "", fmt.Errorf("no Dropbox credentials: set DROPBOX_TOKEN or DROPBOX_REFRESH_TOKEN")
+}
+
+// dropboxContentHash computes Dropbox's content_hash: the SHA256 of the
+// concatenated SHA256 digests of each 4 MiB block.
+func dropboxContentHash(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	overall := sha256.New()
+	buf := make([]byte, dropboxBlockSize)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			sum := sha256.Sum256(buf[:n])
+			overall.Write(sum[:])
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(overall.Sum(nil)), nil
+}
+
+type dropboxMetadata struct {
+	Size           int64     `json:"size"`
+	ServerModified time.Time `json:"server_modified"`
+	ContentHash    string    `json:"content_hash"`
+}
+
+// uploadDropbox uploads file with an upload session: chunks are appended in
+// order and the session is committed to the target path, overwriting. The
+// committed file's content_hash is checked against the local one.
+func uploadDropbox(dest, file, token string, prog *stageProgress) error {
+	token, err := dropboxToken(token)
+	if err != nil {
+		return err
+	}
+	target := dropboxPath(dest, filepath.Base(file))
+	chunk := min(max(int64(partSize)/dropboxBlockSize, 1)*dropboxBlockSize, dropboxMaxChunk)
+	st, err := loadUploadState(file, "dropbox://"+target, chunk)
+	if err != nil {
+		return err
+	}
+	want, err := dropboxContentHash(file)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if st.Session == "" {
+		var resp struct {
+			SessionID string `json:"session_id"`
+		}
+		if err := dropboxCall(dropboxContent+"/2/files/upload_session/start", token,
+			map[string]any{"close": false}, http.NoBody, &resp); err != nil {
+			return err
+		}
+		st.Session, st.Offset = resp.SessionID, 0
+		if err := st.save(); err != nil {
+			return err
+		}
+	}
+	prog.add(st.Offset)
+
+	cursor := func() map[string]any {
+		return map[string]any{"session_id": st.Session, "offset": st.Offset}
+	}
+	for st.Offset < st.Size {
+		n := min(st.PartSize, st.Size-st.Offset)
+		err := withRetry(fmt.Sprintf("upload %s at %d", file, st.Offset), func() error {
+			err := dropboxCall(dropboxContent+"/2/files/upload_session/append_v2", token,
+				map[string]any{"cursor": cursor(), "close": false}, io.NewSectionReader(f, st.Offset, n), nil)
+			if e, ok := err.(*dropboxError); ok && e.Detail.Tag == "incorrect_offset" {
+				// The server has a different amount than we think, e.g. after
+				// a response was lost; continue from its offset.
+				prog.add(e.Detail.CorrectOffset - st.Offset)
+				st.Offset = e.Detail.CorrectOffset
+				return st.save()
+			}
+			if err != nil {
+				return err
+			}
+			prog.add(n)
+			st.Offset += n
+			return st.save()
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	var meta dropboxMetadata
+	commit := map[string]any{"path": target, "mode": "overwrite", "autorename": false, "mute": true}
+	if err := dropboxCall(dropboxContent+"/2/files/upload_session/finish", token,
+		map[string]any{"cursor": cursor(), "commit": commit}, http.NoBody, &meta); err != nil {
+		return err
+	}
+	st.remove()
+	if meta.ContentHash != want {
+		return fmt.Errorf("dropbox content hash mismatch:\nExpected: %s\nActual:   %s", want, meta.ContentHash)
+	}
+	return nil
+}
+
+func dropboxStat(dest, name, token string) (dropboxMetadata, error) {
+	var meta dropboxMetadata
+	token, err := dropboxToken(token)
+	if err != nil {
+		return meta, err
+	}
+	body, _ := json.Marshal(map[string]any{"path": dropboxPath(dest, name)})
+	req, err := http.NewRequest(http.MethodPost, dropboxAPI+"/2/files/get_metadata", strings.NewReader(string(body)))
+	if err != nil {
+		return meta, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	if err := doJSON(req, &meta); err != nil {
+		return meta, fmt.Errorf("dropbox: %w", err)
+	}
+	return meta, nil
+}
+
+// verifyDropboxHash compares the content_hash Dropbox reports for the
+// uploaded zip with the local one, so no download is needed.
+func verifyDropboxHash(dest, localZip, token string) error {
+	meta, err := dropboxStat(dest, filepath.Base(localZip), token)
+	if err != nil {
+		return err
+	}
+	want, err := dropboxContentHash(localZip)
+	if err != nil {
+		return err
+	}
+	if meta.ContentHash != want {
+		return fmt.Errorf("hash mismatch:\nExpected: %s\nActual:   %s", want, meta.ContentHash)
+	}
+	return nil
+}
+
+type dropboxError struct {
+	status  string
+	Summary string `json:"error_summary"`
+	Detail  struct {
+		Tag           string `json:".tag"`
+		CorrectOffset int64  `json:"correct_offset"`
+	} `json:"error"`
+}
+
+func (e *dropboxError) Error() string {
+	return fmt.Sprintf("dropbox: %s %s", e.status, e.Summary)
+}
+
+// dropboxCall makes a content endpoint call: arguments go in the
+// Dropbox-API-Arg header and the body is raw data.
+func dropboxCall(endpoint, token string, arg any, body io.Reader, out any) error {
+	argJSON, err := json.Marshal(arg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, body)
+	if err != nil {
+		return err
+	}
+	if sr, ok := body.(*io.SectionReader); ok {
+		req.ContentLength = sr.Size()
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Dropbox-API-Arg", string(argJSON))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("dropbox: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		e := &dropboxError{status: resp.Status}
+		if json.Unmarshal(data, e) != nil || e.Summary == "" {
+			e.Summary = string(data)
+		}
+		return e
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// With -dryrun each step prints what it would do, as "[DRYRUN] Would ...",
+// without connecting, writing or running anything that changes state. These
+// describe the steps whose effects are spread over several helpers.
+
+// dryRunConnect describes the net use connection netUse would make.
+func dryRunConnect(uncPath, user string) {
+	if user != "" && authMode != "kerberos" {
+		fmt.Printf("[DRYRUN] Would connect to %s as %s\n", uncPath, user)
+		return
+	}
+	fmt.Println("[DRYRUN] Would connect to:", uncPath)
+}
+
+// dryRunAttrs describes the -remote-attrs finishDest would set on dest.
+func dryRunAttrs(dest string) {
+	var attrs []string
+	if setReadOnly {
+		attrs = append(attrs, "read-only")
+	}
+	if setArchive {
+		attrs = append(attrs, "archive")
+	}
+	if len(attrs) > 0 {
+		fmt.Printf("[DRYRUN] Would mark %s %s\n", dest, strings.Join(attrs, " and "))
+	}
+}
+
+// dryRunACLs describes the -file-mode and -acl changes applyACLs would make.
+func dryRunACLs(dest string) {
+	if fileMode != 0 {
+		fmt.Printf("[DRYRUN] Would chmod %04o %s\n", fileMode, dest)
+	}
+	for _, g := range aclGrants {
+		fmt.Printf("[DRYRUN] Would grant %s on %s\n", g, dest)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// A failed stage is reported as a *StageError wrapping one of these and the
+// cause, so callers can test errors.Is(err, ErrCopy) and the process exits
+// with the stage's code.
+var (
+	ErrZip    = errors.New("zip failed")
+	ErrHash   = errors.New("hash failed")
+	ErrSign   = errors.New("sign failed")
+	ErrCopy   = errors.New("copy failed")
+	ErrVerify = errors.New("verification failed")
+)
+
+// Exit codes; 1 is anything else, such as invalid flags or config.
+var exitCodes = []struct {
+	err  error
+	code int
+}{
+	{ErrZip, 3},
+	{ErrHash, 4},
+	{ErrSign, 5},
+	{ErrCopy, 6},
+	{ErrVerify, 7},
+}
+
+// StageError is a stage failure for Subject, the file or target it was
+// working on.
+type StageError struct {
+	Stage   error
+	Subject string
+	Err     error
+}
+
+func (e *StageError) Error() string {
+	if e.Subject == "" {
+		return fmt.Sprintf("%v: %v", e.Stage, e.Err)
+	}
+	return fmt.Sprintf("%v (%s): %v", e.Stage, e.Subject, e.Err)
+}
+
+func (e *StageError) Unwrap() []error {
+	return []error{e.Stage, e.Err}
+}
+
+// stageErr wraps err as a failure of stage on subject. An error that already
+// is a StageError, with a more precise subject, is returned as is.
+func stageErr(stage error, subject string, err error) error {
+	var se *StageError
+	if err == nil || errors.As(err, &se) {
+		return err
+	}
+	return &StageError{Stage: stage, Subject: subject, Err: err}
+}
+
+func exitCode(err error) int {
+	for _, c := range exitCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return 1
+}
+
+// runError is the error a failed run ends with, for the report.
+var runError error
+
+// fail reports err and exits with its code.
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "❌ %s\n", redactSecrets(err.Error()))
+	runError = err
+	exit(exitCode(err))
+}
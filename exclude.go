@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+type excludeRule struct {
+	pattern string
+	mode    string
+	source  string // the flag that added the rule, for -list-excluded
+}
+
+var excludeRules []excludeRule
+
+var excludePresets = map[string][]string{
+	"node":   {"node_modules", ".npm", ".yarn/cache", "npm-debug.log*", "yarn-error.log"},
+	"dotnet": {"bin", "obj", ".vs", "TestResults", "*.user", "*.suo"},
+	"python": {"__pycache__", "*.py[co]", ".venv", "venv", ".tox", ".pytest_cache", ".mypy_cache", "*.egg-info"},
+	"git":    {".git"},
+}
+
+// addExcludePresets appends the patterns of each named preset. Presets always
+// use "path" matching so they apply at any depth whatever -exclude-match says.
+func addExcludePresets(names []string) error {
+	for _, list := range names {
+		for _, name := range strings.Split(list, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			patterns, ok := excludePresets[name]
+			if !ok {
+				return fmt.Errorf("unknown -preset %q (want node, dotnet, python or git)", name)
+			}
+			for _, p := range patterns {
+				excludeRules = append(excludeRules, excludeRule{pattern: p, mode: "path", source: "-preset " + name})
+			}
+		}
+	}
+	return nil
+}
+
+func buildExcludeRules(patterns []string, mode string) error {
+	switch mode {
+	case "path", "base", "anchored":
+	default:
+		return fmt.Errorf("invalid -exclude-match %q (want path, base or anchored)", mode)
+	}
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !doublestar.ValidatePattern(strings.TrimPrefix(p, "/")) {
+			return fmt.Errorf("invalid exclude pattern %q", p)
+		}
+		excludeRules = append(excludeRules, excludeRule{pattern: p, mode: mode, source: "-exclude"})
+	}
+	return nil
+}
+
+// isExcluded reports whether rel (slash separated, relative to the source
+// root) matches any exclude rule.
+func isExcluded(rel string) bool {
+	_, ok := excludedBy(rel)
+	return ok
+}
+
+// excludedBy returns the first exclude rule matching rel, described as the
+// flag and pattern that added it, e.g. "-preset node: node_modules".
+func excludedBy(rel string) (string, bool) {
+	for _, r := range excludeRules {
+		if r.match(rel) {
+			return r.String(), true
+		}
+	}
+	return "", false
+}
+
+func (r excludeRule) String() string {
+	if r.source == "-exclude" && r.mode != "path" {
+		return fmt.Sprintf("-exclude %s (-exclude-match %s)", r.pattern, r.mode)
+	}
+	if r.source == "-exclude" {
+		return "-exclude " + r.pattern
+	}
+	return r.source + ": " + r.pattern
+}
+
+func (r excludeRule) match(rel string) bool {
+	switch r.mode {
+	case "base":
+		return doublestar.MatchUnvalidated(r.pattern, path.Base(rel))
+	case "anchored":
+		return doublestar.MatchUnvalidated(strings.TrimPrefix(r.pattern, "/"), rel)
+	}
+
+	// "path": a leading slash anchors the pattern at the root, otherwise it
+	// may match at any depth, so "*.log" also excludes "a/b/debug.log".
+	if strings.HasPrefix(r.pattern, "/") {
+		return doublestar.MatchUnvalidated(r.pattern[1:], rel)
+	}
+	for p := rel; ; {
+		if doublestar.MatchUnvalidated(r.pattern, p) {
+			return true
+		}
+		i := strings.IndexByte(p, '/')
+		if i < 0 {
+			return false
+		}
+		p = p[i+1:]
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// runCtx is cancelled on Ctrl+C or SIGTERM, killing running external
+// commands; -cmd-timeout limits each one.
+var (
+	runCtx      = context.Background()
+	runningCmds sync.WaitGroup
+)
+
+// cmdWaitDelay is how long to wait for a killed command's output pipes to
+// close; a grandchild (gpg-agent, a pinentry) may hold them open.
+const cmdWaitDelay = 5 * time.Second
+
+// errInterrupted is what a stage fails with once runCtx is cancelled.
+var errInterrupted = errors.New("interrupted")
+
+// interruptGrace is how long an interrupted run gets to stop its stage and
+// exit through fail before the signal handler exits on its own.
+const interruptGrace = 30 * time.Second
+
+// setupCancel cancels runCtx on the first interrupt. That kills running
+// commands and fails the stage in progress, so the run exits through fail
+// and exit like any other failure, from main's goroutine. Only if the stage
+// doesn't stop within interruptGrace, or on a second interrupt, does the
+// handler exit itself.
+func setupCancel() {
+	ctx, cancel := context.WithCancel(context.Background())
+	runCtx = ctx
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		fmt.Fprintf(os.Stderr, "\n❌ Interrupted (%s), stopping\n", s)
+		cancel()
+		select {
+		case <-sig:
+		case <-time.After(interruptGrace):
+		}
+		exit(130)
+	}()
+}
+
+var (
+	exitHooks []func(code int)
+	exitMu    sync.Mutex
+)
+
+// atExit runs f when zipper exits through exit, fail or an interrupt.
+func atExit(f func(code int)) {
+	exitHooks = append(exitHooks, f)
+}
+
+// exit disconnects the shared net use sessions, runs the atExit hooks and
+// exits with code, or 130 if the run was interrupted. Only the first caller
+// gets through; a second one (the interrupt handler giving up on a stage, or
+// main failing meanwhile) waits for it, so the hooks never run twice or
+// concurrently.
+func exit(code int) {
+	exitMu.Lock()
+	if runCtx.Err() != nil {
+		code = 130
+		runningCmds.Wait()
+	}
+	closeShares()
+	for i := len(exitHooks) - 1; i >= 0; i-- {
+		exitHooks[i](code)
+	}
+	os.Exit(code)
+}
+
+// commandRecord is an external command zipper ran, for the JSON report.
+type commandRecord struct {
+	Command  string    `json:"command"`
+	Started  time.Time `json:"started"`
+	Seconds  float64   `json:"seconds"`
+	ExitCode int       `json:"exit_code"`
+	Error    string    `json:"error,omitempty"`
+}
+
+var (
+	logCommands bool
+	commandsMu  sync.Mutex
+	commandLog  []commandRecord
+)
+
+// recordCommand logs args, run from start until now, with known secrets
+// redacted. The exit code is -1 for a command that didn't start or was
+// killed.
+func recordCommand(args []string, start time.Time, err error) {
+	if !logCommands {
+		return
+	}
+	rec := commandRecord{
+		Command: redactSecrets(joinWindowsArgs(args)),
+		Started: start.UTC(),
+		Seconds: time.Since(start).Round(time.Millisecond).Seconds(),
+	}
+	if err != nil {
+		rec.ExitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			rec.ExitCode = exitErr.ExitCode()
+		}
+		rec.Error = redactSecrets(err.Error())
+	}
+	commandsMu.Lock()
+	defer commandsMu.Unlock()
+	commandLog = append(commandLog, rec)
+}
+
+func commands() []commandRecord {
+	commandsMu.Lock()
+	defer commandsMu.Unlock()
+	return append([]commandRecord(nil), commandLog...)
+}
+
+// commandOutput is cmd.Output, recorded in the command log.
+func commandOutput(cmd *exec.Cmd) ([]byte, error) {
+	start := time.Now()
+	out, err := cmd.Output()
+	recordCommand(cmd.Args, start, err)
+	return out, err
+}
+
+// commandCombinedOutput is cmd.CombinedOutput, recorded in the command log
+// and converted to UTF-8 (see consoleText).
+func commandCombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	recordCommand(cmd.Args, start, err)
+	return consoleText(out), err
+}
+
+// runCommand runs name with args, killing it when runCtx is cancelled or
+// -cmd-timeout passes, and returns its stdout and stderr separately. Stdout
+// is returned as is, as it may be data; stderr is converted to UTF-8.
+func runCommand(stdin io.Reader, name string, args ...string) ([]byte, []byte, error) {
+	runningCmds.Add(1)
+	defer runningCmds.Done()
+	ctx := runCtx
+	if cmdTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cmdTimeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = commandEnv(name)
+	cmd.WaitDelay = cmdWaitDelay
+	cmd.Stdin = stdin
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	start := time.Now()
+	err := cmd.Run()
+	recordCommand(cmd.Args, start, err)
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		err = fmt.Errorf("%s killed after -cmd-timeout %s", name, cmdTimeout)
+	case ctx.Err() != nil:
+		err = fmt.Errorf("%s cancelled", name)
+	}
+	return stdout.Bytes(), consoleText(stderr.Bytes()), err
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// runFetch implements "zipper fetch", the consumer's side of a release: it
+// downloads (or copies from a share) an artifact into a temporary folder next
+// to its destination, checks its SHA256 and signature, and only then moves it
+// into place. A failed check leaves nothing behind.
+func runFetch(args []string) int {
+	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	expect := fs.String("expect-sha256", "", "Expected SHA256: the hash, \"sidecar\" for the .sha256 next to the artifact, or a .sha256 file path or URL")
+	sig := fs.String("sig", "", "Signature to check: \"auto\" to find zipper's signature next to the artifact, or a path or URL")
+	pubKey := fs.String("pubkey", "", "PEM public key to check KMS/PKCS#11 .sig signatures with (GPG uses the keyring)")
+	out := fs.String("out", "", "Where to put the artifact (default: its name, in the current directory)")
+	user := fs.String("user", "", "Username for a UNC source")
+	pass := fs.String("pass", "", "Password for -user, or a secret reference (env:, keyring:, dpapi:, vault:...)")
+	fs.StringVar(&proxyURL, "proxy", "", "HTTP(S) proxy (default from HTTPS_PROXY)")
+	fs.StringVar(&tlsCA, "tls-ca", "", "PEM bundle of extra CAs to trust")
+	fs.StringVar(&tlsCert, "tls-cert", "", "PEM client certificate for servers that require mutual TLS")
+	fs.StringVar(&tlsKey, "tls-key", "", "PEM private key for -tls-cert")
+	// Flags may follow the source, as in "zipper fetch URL -expect-sha256 sidecar".
+	fs.Parse(args)
+	var rest []string
+	for fs.NArg() > 0 {
+		rest = append(rest, fs.Arg(0))
+		fs.Parse(fs.Args()[1:])
+	}
+	if len(rest) != 1 || *expect == "" {
+		fmt.Fprintln(os.Stderr, "Usage: zipper fetch <url-or-path> -expect-sha256 <hash|sidecar|FILE.sha256> [-sig auto|FILE] [-pubkey KEY.pem] [-out FILE]")
+		return 2
+	}
+	src := rest[0]
+	if err := setupProxy(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	if err := setupTLS(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	var pub crypto.PublicKey
+	if *pubKey != "" {
+		var err error
+		if pub, err = loadPublicKey(*pubKey); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ -pubkey: %v\n", err)
+			return 2
+		}
+	}
+	setupCancel()
+
+	name := fetchName(src)
+	if name == "" {
+		fmt.Fprintf(os.Stderr, "❌ %s doesn't name a file\n", redactURL(src))
+		return 2
+	}
+	dest := *out
+	if dest == "" {
+		dest = name
+	}
+	f := &fetcher{}
+	defer f.close()
+	if isUNC(src) {
+		password, err := resolveSecret(*pass, *user)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ -pass: %v\n", err)
+			return 2
+		}
+		if err := f.connect(src, *user, password); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", redactSecrets(err.Error()))
+			return 1
+		}
+	}
+
+	// The temporary folder is next to dest so the final move is a rename.
+	tmp, err := os.MkdirTemp(filepath.Dir(dest), ".zipper-fetch-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(tmp)
+	file := filepath.Join(tmp, name)
+
+	sum, err := f.fetch(src, file, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Download failed: %v\n", redactSecrets(err.Error()))
+		return 1
+	}
+	fmt.Printf("✅ Downloaded %s (%d bytes)\n", redactURL(src), fileSize(file))
+
+	expected := *expect
+	if !isSHA256Hex(expected) {
+		loc := expected
+		if loc == "sidecar" {
+			loc = siblingOf(src, ".sha256")
+		}
+		if _, err := f.fetch(loc, file+".sha256", false); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Cannot get the checksum from %s: %v\n", redactURL(loc), redactSecrets(err.Error()))
+			return 1
+		}
+		data, _ := os.ReadFile(file + ".sha256")
+		if res := checkSidecar(data, name, sum); !res.OK {
+			fmt.Fprintf(os.Stderr, "❌ SHA256 check failed: %s\nActual: %s\n", res.Detail, sum)
+			return 1
+		}
+	} else if !strings.EqualFold(expected, sum) {
+		fmt.Fprintf(os.Stderr, "❌ SHA256 mismatch:\nExpected: %s\nActual:   %s\n", strings.ToLower(expected), sum)
+		return 1
+	}
+	fmt.Printf("✅ SHA256 verified: %s\n", sum)
+
+	if *sig == "" {
+		fmt.Fprintln(os.Stderr, "⚠️  No -sig given: the checksum was verified, but not who published it")
+	} else {
+		sigFile, err := f.fetchSignature(src, *sig, file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Cannot get the signature: %v\n", redactSecrets(err.Error()))
+			return 1
+		}
+		res := (&verifier{pub: pub}).checkSignature(sigFile, file, sum)
+		if !res.OK {
+			fmt.Fprintf(os.Stderr, "❌ Signature check failed: %s\n", res.Detail)
+			return 1
+		}
+		fmt.Printf("✅ Signature verified (%s)\n", res.Detail)
+	}
+
+	if err := os.Rename(file, dest); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	fmt.Printf("✅ Saved %s\n", dest)
+	return 0
+}
+
+// fetcher reads artifacts from URLs, local paths and shares. A share is
+// connected, with net use on Windows and mounted elsewhere, for the duration
+// of the fetch.
+type fetcher struct {
+	mount string // mount point of share
+	share string // //server/share mounted there
+}
+
+func (f *fetcher) connect(src, user, pass string) error {
+	share := uncShareRoot(src)
+	if runtime.GOOS == "windows" {
+		return useShare(share, user, pass)
+	}
+	dir, _, err := mountSMB(share, user, pass)
+	if err != nil {
+		return err
+	}
+	f.mount, f.share = dir, share
+	return nil
+}
+
+func (f *fetcher) close() {
+	closeShares()
+	if f.mount != "" {
+		unmountDir(f.mount)
+	}
+}
+
+// local returns where UNC path p is under the mounted share, if it is.
+func (f *fetcher) local(p string) string {
+	if f.mount == "" || !isUNC(p) {
+		return p
+	}
+	parts := strings.FieldsFunc(p, func(r rune) bool { return r == '\\' || r == '/' })
+	mounted := strings.FieldsFunc(f.share, func(r rune) bool { return r == '\\' || r == '/' })
+	if len(parts) < 2 || !strings.EqualFold(parts[0], mounted[0]) || !strings.EqualFold(parts[1], mounted[1]) {
+		return p
+	}
+	return filepath.Join(append([]string{f.mount}, parts[2:]...)...)
+}
+
+// fetch copies loc to file, with retries, and returns its SHA256. A missing
+// file isn't retried. Artifacts show progress, sidecars don't.
+func (f *fetcher) fetch(loc, file string, progress bool) (string, error) {
+	var sum string
+	err := withRetry("download "+redactURL(loc), func() error {
+		var err error
+		sum, err = f.fetchOnce(loc, file, progress)
+		return err
+	})
+	return sum, err
+}
+
+func (f *fetcher) fetchOnce(loc, file string, progress bool) (string, error) {
+	var in io.ReadCloser
+	var size int64
+	if strings.HasPrefix(loc, "https://") || strings.HasPrefix(loc, "http://") {
+		// No overall timeout: large artifacts take as long as they take.
+		client := &http.Client{Transport: httpClient.Transport}
+		resp, err := client.Get(loc)
+		if err != nil {
+			return "", err
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+		case http.StatusNotFound:
+			resp.Body.Close()
+			return "", fmt.Errorf("%s: %w", resp.Status, os.ErrNotExist)
+		default:
+			resp.Body.Close()
+			return "", fmt.Errorf("%s", resp.Status)
+		}
+		in, size = resp.Body, resp.ContentLength
+	} else {
+		r, err := os.Open(f.local(loc))
+		if err != nil {
+			return "", err
+		}
+		if info, err := r.Stat(); err == nil {
+			size = info.Size()
+		}
+		in = r
+	}
+	defer in.Close()
+
+	var prog *stageProgress
+	if progress {
+		prog = startProgress("download", max(size, 0))
+		prog.setFile(filepath.Base(file))
+		defer prog.finish()
+	}
+	out, err := os.Create(file)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, h, prog), in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	if size > 0 && fileSize(file) != size {
+		return "", fmt.Errorf("got %d of %d bytes", fileSize(file), size)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fetchSignature gets the signature at loc, or with "auto" the first of
+// zipper's signature files next to src, as a sibling of file named the way
+// checkSignature recognizes. A GPG signature of the .sha256 sidecar brings
+// the sidecar too if it isn't there yet.
+func (f *fetcher) fetchSignature(src, loc, file string) (string, error) {
+	candidates := []string{loc}
+	if loc == "auto" {
+		candidates = nil
+		for _, ext := range []string{".sha256.asc", ".sha256.sig", ".sig"} {
+			candidates = append(candidates, siblingOf(src, ext))
+		}
+	}
+	for _, c := range candidates {
+		ext := ".sig"
+		for _, e := range []string{".sha256.asc", ".sha256.sig"} {
+			if strings.HasSuffix(redactURL(c), e) {
+				ext = e
+			}
+		}
+		sigFile := file + ext
+		_, err := f.fetch(c, sigFile, false)
+		if errors.Is(err, os.ErrNotExist) && loc == "auto" {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if ext == ".sha256.sig" {
+			if _, err := os.Stat(file + ".sha256"); err != nil {
+				sidecar := strings.Replace(c, ".sha256.sig", ".sha256", 1)
+				if _, err := f.fetch(sidecar, file+".sha256", false); err != nil {
+					return "", fmt.Errorf("the signed .sha256 sidecar: %w", err)
+				}
+			}
+		}
+		return sigFile, nil
+	}
+	return "", fmt.Errorf("none of %s found next to the artifact", strings.Join([]string{".sha256.asc", ".sha256.sig", ".sig"}, ", "))
+}
+
+// siblingOf returns the file named like loc plus ext, keeping a URL's query
+// (a SAS token, say).
+func siblingOf(loc, ext string) string {
+	if base, query, ok := strings.Cut(loc, "?"); ok && strings.Contains(loc, "://") {
+		return base + ext + "?" + query
+	}
+	return loc + ext
+}
+
+// fetchName is the artifact's file name in loc.
+func fetchName(loc string) string {
+	loc = redactURL(loc)
+	if i := strings.LastIndexAny(loc, `/\`); i >= 0 {
+		loc = loc[i+1:]
+	}
+	return loc
+}
+
+func isSHA256Hex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil && len(s) == 64
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"archive/zip"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// -first puts the files matching its patterns at the start of the archive,
+// in pattern order, and stores them uncompressed with their sizes in the
+// local headers. A consumer streaming the zip (an installer reading its
+// manifest, say) can then read them from the first bytes of the download
+// without the central directory at the end.
+
+var firstPatterns stringList
+
+func validateFirst() error {
+	for _, p := range firstPatterns {
+		if !doublestar.ValidatePattern(strings.TrimPrefix(p, "/")) {
+			return fmt.Errorf("invalid -first pattern %q", p)
+		}
+	}
+	return nil
+}
+
+// firstRank is 1 + the index of the first -first pattern matching rel, or 0
+// when none does. Patterns match like -exclude ones in path mode.
+func firstRank(rel string) int {
+	for i, p := range firstPatterns {
+		if (excludeRule{pattern: p, mode: "path"}).match(rel) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// orderFirst returns files with the -first ones moved to the front.
+func orderFirst(files []sourceFile) []sourceFile {
+	if !slices.ContainsFunc(files, func(f sourceFile) bool { return f.first > 0 }) {
+		return files
+	}
+	files = slices.Clone(files)
+	slices.SortStableFunc(files, func(a, b sourceFile) int {
+		if a.first == 0 || b.first == 0 {
+			return cmp.Compare(b.first, a.first) // 0 sorts last
+		}
+		return cmp.Compare(a.first, b.first)
+	})
+	return files
+}
+
+// addStored writes a -first file as a stored entry. The CRC has to be in
+// the local header, so the file is read twice: once to checksum it and once
+// to copy it.
+func addStored(zw *zip.Writer, item zipItem, prog *stageProgress) (string, error) {
+	var h hash.Hash
+	crc := crc32.NewIEEE()
+	w := io.Writer(crc)
+	if hashingFiles() {
+		h = sha256.New()
+		w = io.MultiWriter(crc, h)
+	}
+	fr, err := openWithRetry(item.file.path)
+	if err != nil {
+		return "", err
+	}
+	size, err := io.Copy(w, fr)
+	fr.Close()
+	if err != nil {
+		return "", err
+	}
+
+	item.crc, item.size = crc.Sum32(), size
+	fw, err := zw.CreateRaw(item.header(zip.Store, uint64(size)))
+	if err != nil {
+		return "", err
+	}
+	if fr, err = openWithRetry(item.file.path); err != nil {
+		return "", err
+	}
+	defer fr.Close()
+	n, err := io.Copy(io.MultiWriter(pace(fw), prog), fr)
+	if err == nil && n != size {
+		err = fmt.Errorf("file changed while zipping (%d bytes, then %d)", size, n)
+	}
+	if err != nil || h == nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"archive/zip"
+	"path/filepath"
+	"testing"
+)
+
+func TestFirst(t *testing.T) {
+	work := t.TempDir()
+	src := filepath.Join(work, "src")
+	if err := expandFixture("testdata/basic.txt", src); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := goldenRun(src, work, "first.zip", []string{"-first", "README.txt", "-first", "dist/**/*.js"}); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(filepath.Join(work, "first.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	// Pattern order, then the rest as usual.
+	want := []string{"src/README.txt", "src/dist/app.js"}
+	if len(zr.File) <= len(want) {
+		t.Fatalf("got %d entries, want more than %d", len(zr.File), len(want))
+	}
+	for i, f := range zr.File {
+		if i < len(want) {
+			if f.Name != want[i] {
+				t.Errorf("entry %d is %s, want %s", i, f.Name, want[i])
+			}
+			if f.Method != zip.Store {
+				t.Errorf("%s: method %d, want store", f.Name, f.Method)
+			}
+			if f.Flags&0x8 != 0 {
+				t.Errorf("%s: sizes are in a data descriptor, want them in the local header", f.Name)
+			}
+			continue
+		}
+		if f.Method == zip.Store && f.UncompressedSize64 > 0 {
+			t.Errorf("%s: stored, but it isn't a -first file", f.Name)
+		}
+	}
+}
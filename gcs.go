@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// uploadGCS uploads file with a GCS resumable upload. STORAGE_EMULATOR_HOST
+// overrides the endpoint.
+func uploadGCS(dest, file, token string, prog *stageProgress) error {
+	bucket, prefix := splitBucket(dest)
+	key := objectKey(prefix, file)
+	st, err := loadUploadState(file, "gs://"+bucket+"/"+key, googleChunkSize())
+	if err != nil {
+		return err
+	}
+	token, err = googleToken(token, scopeStorage)
+	if err != nil {
+		return err
+	}
+	return resumableUpload(st, file, prog, func() (string, error) {
+		u := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=resumable&name=%s",
+			gcsEndpoint(), url.PathEscape(bucket), url.QueryEscape(key))
+		return startResumable(http.MethodPost, u, token, st.Size, nil)
+	})
+}
+
+func gcsEndpoint() string {
+	if h := os.Getenv("STORAGE_EMULATOR_HOST"); h != "" {
+		if !strings.Contains(h, "://") {
+			h = "http://" + h
+		}
+		return strings.TrimRight(h, "/")
+	}
+	return "https://storage.googleapis.com"
+}
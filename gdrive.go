@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Google Drive targets are written gdrive://<folder ID>; the folder may be in
+// a shared drive. An existing file of the same name in the folder gets a new
+// revision instead of a duplicate.
+
+var driveEndpoint = "https://www.googleapis.com"
+
+type driveFile struct {
+	ID           string    `json:"id"`
+	Size         string    `json:"size"`
+	ModifiedTime time.Time `json:"modifiedTime"`
+}
+
+func driveFolder(dest string) string {
+	return strings.Trim(strings.TrimPrefix(dest, "gdrive://"), "/")
+}
+
+func uploadDrive(dest, file, token string, prog *stageProgress) error {
+	folder := driveFolder(dest)
+	name := filepath.Base(file)
+	st, err := loadUploadState(file, "gdrive://"+folder+"/"+name, googleChunkSize())
+	if err != nil {
+		return err
+	}
+	token, err = googleToken(token, scopeDrive)
+	if err != nil {
+		return err
+	}
+	return resumableUpload(st, file, prog, func() (string, error) {
+		existing, err := driveFind(folder, name, token)
+		if err != nil {
+			return "", err
+		}
+		if existing != nil {
+			u := driveEndpoint + "/upload/drive/v3/files/" + url.PathEscape(existing.ID) + "?uploadType=resumable&supportsAllDrives=true"
+			return startResumable(http.MethodPatch, u, token, st.Size, map[string]any{})
+		}
+		u := driveEndpoint + "/upload/drive/v3/files?uploadType=resumable&supportsAllDrives=true"
+		return startResumable(http.MethodPost, u, token, st.Size, map[string]any{"name": name, "parents": []string{folder}})
+	})
+}
+
+// driveFind returns the file called name in folder, or nil.
+func driveFind(folder, name, token string) (*driveFile, error) {
+	q := fmt.Sprintf("'%s' in parents and name = '%s' and trashed = false", driveQuote(folder), driveQuote(name))
+	u := driveEndpoint + "/drive/v3/files?" + url.Values{
+		"q":                         {q},
+		"fields":                    {"files(id,size,modifiedTime)"},
+		"supportsAllDrives":         {"true"},
+		"includeItemsFromAllDrives": {"true"},
+	}.Encode()
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	var list struct {
+		Files []driveFile `json:"files"`
+	}
+	if err := doJSON(req, &list); err != nil {
+		return nil, fmt.Errorf("drive: %w", err)
+	}
+	if len(list.Files) == 0 {
+		return nil, nil
+	}
+	return &list.Files[0], nil
+}
+
+func driveQuote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
+
+func driveStat(dest, name, token string) (int64, time.Time, error) {
+	token, err := googleToken(token, scopeDrive)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	f, err := driveFind(driveFolder(dest), name, token)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if f == nil {
+		return 0, time.Time{}, fmt.Errorf("drive: %s not found", name)
+	}
+	size, err := strconv.ParseInt(f.Size, 10, 64)
+	return size, f.ModifiedTime, err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// GitHub Actions workflow commands, only emitted with -gha. See
+// https://docs.github.com/actions/using-workflows/workflow-commands-for-github-actions
+
+func ghaGroup(title string) {
+	if ghaMode {
+		fmt.Println("::group::" + ghaEscape(title))
+	}
+}
+
+func ghaEndGroup() {
+	if ghaMode {
+		fmt.Println("::endgroup::")
+	}
+}
+
+// ghaError emits an error annotation attached to file (may be empty).
+func ghaError(file string, err error) {
+	if !ghaMode {
+		return
+	}
+	msg := redactSecrets(err.Error())
+	if file == "" {
+		fmt.Printf("::error::%s\n", ghaEscape(msg))
+		return
+	}
+	fmt.Printf("::error file=%s,title=%s::%s\n", ghaEscapeProperty(file), ghaEscapeProperty(file), ghaEscape(msg))
+}
+
+// ghaOutput appends a step output to $GITHUB_OUTPUT.
+func ghaOutput(name, value string) error {
+	if !ghaMode {
+		return nil
+	}
+	path := os.Getenv("GITHUB_OUTPUT")
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s=%s\n", name, value)
+	return err
+}
+
+func ghaEscape(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func ghaEscapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestGolden runs zipper on fixture trees and compares the archives it makes
+// with golden files in testdata. Each case runs twice to catch output that
+// isn't deterministic. After an intended change, regenerate the golden files
+// with:
+//
+//	go test -run TestGolden -update
+//
+// A fixture is a text file holding a tree:
+//
+//	-- dist/app.js --
+//	console.log("hi")
+//	-- dist/empty/ --
+//	-- node_modules/x/index.js --
+//	module.exports = 1
+//
+// Every file and directory gets mode 0644/0755 and fixtureTime as its
+// modification time, so the tree is the same on every machine.
+
+var update = flag.Bool("update", false, "Rewrite the golden files in testdata instead of comparing with them")
+
+var goldenTests = []struct {
+	name    string
+	fixture string
+	golden  string
+	flags   []string
+}{
+	{"basic", "testdata/basic.txt", "testdata/basic.golden.json", nil},
+	{"presets", "testdata/basic.txt", "testdata/basic-presets.golden.json",
+		[]string{"-preset", "node,git", "-exclude", "*.log", "-hash", "-file-hashes"}},
+	{"first", "testdata/basic.txt", "testdata/basic-first.golden.json",
+		[]string{"-hash", "-file-hashes", "-first", "dist/assets/*", "-first", "README.txt"}},
+}
+
+// TestMain lets the tests run zipper as a separate process: the test binary
+// re-executed with ZIPPER_TEST_MAIN=1 is zipper itself.
+func TestMain(m *testing.M) {
+	if os.Getenv("ZIPPER_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestGolden(t *testing.T) {
+	for _, tt := range goldenTests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			src := filepath.Join(work, "src")
+			if err := expandFixture(tt.fixture, src); err != nil {
+				t.Fatalf("%s: %v", tt.fixture, err)
+			}
+			got, err := goldenRun(src, filepath.Join(work, "run1"), "fixture.zip", tt.flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, err := goldenRun(src, filepath.Join(work, "run2"), "fixture.zip", tt.flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := diffGolden(got, again); len(diff) > 0 {
+				t.Fatalf("run 2 differs from run 1, the output isn't deterministic:\n  %s", strings.Join(diff, "\n  "))
+			}
+
+			if *update {
+				data, err := json.MarshalIndent(got, "", "  ")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(tt.golden, append(data, '\n'), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			data, err := os.ReadFile(tt.golden)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			var want golden
+			if err := json.Unmarshal(data, &want); err != nil {
+				t.Fatalf("%s: %v", tt.golden, err)
+			}
+			if diff := diffGolden(want, got); len(diff) > 0 {
+				t.Errorf("result differs from %s:\n  %s", tt.golden, strings.Join(diff, "\n  "))
+			}
+		})
+	}
+}
+
+var fixtureTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// golden describes the files a zipper run produced.
+type golden struct {
+	Archives []goldenArchive `json:"archives"`
+	Files    []string        `json:"files"` // every output file, sidecars included
+}
+
+type goldenArchive struct {
+	Name    string        `json:"name"`
+	Entries []goldenEntry `json:"entries"`
+}
+
+type goldenEntry struct {
+	Name     string `json:"name"`
+	Size     uint64 `json:"size"`
+	SHA256   string `json:"sha256"`
+	Method   string `json:"method"`
+	Mode     string `json:"mode"`
+	Modified string `json:"modified,omitempty"`
+}
+
+// expandFixture writes the tree in fixture file to dir.
+func expandFixture(file, dir string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	type entry struct {
+		name    string
+		content bytes.Buffer
+	}
+	var entries []*entry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if name, ok := strings.CutPrefix(line, "-- "); ok && strings.HasSuffix(name, " --") {
+			name = strings.TrimSuffix(name, " --")
+			if name == "" || filepath.IsAbs(name) || slices.Contains(strings.Split(name, "/"), "..") {
+				return fmt.Errorf("line %d: invalid path %q", n, name)
+			}
+			entries = append(entries, &entry{name: name})
+			continue
+		}
+		if len(entries) == 0 {
+			continue // a comment before the first file
+		}
+		e := entries[len(entries)-1]
+		e.content.WriteString(line + "\n")
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		p := filepath.Join(dir, filepath.FromSlash(strings.TrimSuffix(e.name, "/")))
+		if strings.HasSuffix(e.name, "/") {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, e.content.Bytes(), 0644); err != nil {
+			return err
+		}
+		if err := os.Chmod(p, 0644); err != nil {
+			return err
+		}
+		if err := os.Chtimes(p, fixtureTime, fixtureTime); err != nil {
+			return err
+		}
+	}
+	// Directory times last, as creating their files changed them.
+	return filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			err = os.Chtimes(p, fixtureTime, fixtureTime)
+		}
+		return err
+	})
+}
+
+// goldenRun runs zipper on src with flags, writing to dir, and describes the
+// result.
+func goldenRun(src, dir, name string, flags []string) (golden, error) {
+	var g golden
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return g, err
+	}
+	args := append(slices.Clone(flags), "-src", src, "-out", filepath.Join(dir, name))
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "ZIPPER_TEST_MAIN=1")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return g, fmt.Errorf("zipper %s failed: %s\n%s", joinWindowsArgs(args), err, output)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return g, err
+	}
+	for _, f := range files {
+		g.Files = append(g.Files, f.Name())
+		if !strings.HasSuffix(f.Name(), ".zip") {
+			continue
+		}
+		a, err := describeArchive(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return g, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		g.Archives = append(g.Archives, a)
+	}
+	return g, nil
+}
+
+// describeArchive lists the entries of the zip file, in archive order.
+func describeArchive(file string) (goldenArchive, error) {
+	a := goldenArchive{Name: filepath.Base(file)}
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return a, err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		e := goldenEntry{
+			Name:   f.Name,
+			Size:   f.UncompressedSize64,
+			Method: fmt.Sprintf("method %d", f.Method),
+			Mode:   fmt.Sprintf("%04o", f.Mode().Perm()),
+		}
+		switch f.Method {
+		case zip.Store:
+			e.Method = "store"
+		case zip.Deflate:
+			e.Method = "deflate"
+		}
+		if !f.Modified.IsZero() {
+			e.Modified = f.Modified.UTC().Format(time.RFC3339)
+		}
+		r, err := f.Open()
+		if err != nil {
+			return a, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, r)
+		r.Close()
+		if err != nil {
+			return a, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		e.SHA256 = hex.EncodeToString(h.Sum(nil))
+		a.Entries = append(a.Entries, e)
+	}
+	return a, nil
+}
+
+// diffGolden lists the differences between want and got, one per line.
+func diffGolden(want, got golden) []string {
+	var diff []string
+	for _, f := range want.Files {
+		if !slices.Contains(got.Files, f) {
+			diff = append(diff, "- file "+f)
+		}
+	}
+	for _, f := range got.Files {
+		if !slices.Contains(want.Files, f) {
+			diff = append(diff, "+ file "+f)
+		}
+	}
+	for _, wa := range want.Archives {
+		i := slices.IndexFunc(got.Archives, func(a goldenArchive) bool { return a.Name == wa.Name })
+		if i < 0 {
+			continue // reported as a missing file
+		}
+		ga := got.Archives[i]
+		var wantNames, gotNames []string
+		for _, e := range wa.Entries {
+			wantNames = append(wantNames, e.Name)
+		}
+		for _, e := range ga.Entries {
+			gotNames = append(gotNames, e.Name)
+		}
+		for _, we := range wa.Entries {
+			j := slices.Index(gotNames, we.Name)
+			if j < 0 {
+				diff = append(diff, fmt.Sprintf("- %s: %s", wa.Name, we.Name))
+				continue
+			}
+			if ge := ga.Entries[j]; ge != we {
+				diff = append(diff, fmt.Sprintf("~ %s: %s: %s", wa.Name, we.Name, entryChanges(we, ge)))
+			}
+		}
+		for _, ge := range ga.Entries {
+			if !slices.Contains(wantNames, ge.Name) {
+				diff = append(diff, fmt.Sprintf("+ %s: %s", wa.Name, ge.Name))
+			}
+		}
+		if len(diff) == 0 && !slices.Equal(wantNames, gotNames) {
+			diff = append(diff, fmt.Sprintf("~ %s: entry order changed", wa.Name))
+		}
+	}
+	return diff
+}
+
+func entryChanges(want, got goldenEntry) string {
+	var changes []string
+	field := func(name, w, g string) {
+		if w != g {
+			changes = append(changes, fmt.Sprintf("%s %s → %s", name, w, g))
+		}
+	}
+	field("size", fmt.Sprint(want.Size), fmt.Sprint(got.Size))
+	field("sha256", want.SHA256, got.SHA256)
+	field("method", want.Method, got.Method)
+	field("mode", want.Mode, got.Mode)
+	field("modified", want.Modified, got.Modified)
+	return strings.Join(changes, ", ")
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Google resumable upload chunks must be multiples of 256 KiB.
+const googleChunkAlign = 256 << 10
+
+const (
+	scopeStorage = "https://www.googleapis.com/auth/devstorage.read_write"
+	scopeDrive   = "https://www.googleapis.com/auth/drive"
+)
+
+// googleToken returns an OAuth access token for scope from, in order, an
+// explicit token (the target credential's password), GOOGLE_OAUTH_ACCESS_TOKEN,
+// the service account key in GOOGLE_APPLICATION_CREDENTIALS, or gcloud.
+func googleToken(explicit, scope string) (string, error) {
+	if explicit != "" {
+		return explicit, nil
+	}
+	if t := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); t != "" {
+		return t, nil
+	}
+	if keyFile := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); keyFile != "" {
+		return serviceAccountToken(keyFile, scope)
+	}
+	args := []string{"auth", "print-access-token"}
+	if scope != scopeStorage {
+		// Only service account logins can mint tokens for other scopes.
+		args = append(args, "--scopes", scope)
+	}
+	out, err := commandOutput(cloudCommand("gcloud", args...))
+	if err != nil {
+		return "", fmt.Errorf("no Google credentials: set GOOGLE_OAUTH_ACCESS_TOKEN or GOOGLE_APPLICATION_CREDENTIALS, or log in with gcloud (%s)", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// serviceAccountToken exchanges a signed JWT for an access token (the OAuth
+// 2.0 JWT bearer flow used by Google service accounts).
+func serviceAccountToken(keyFile, scope string) (string, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return "", err
+	}
+	var key struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &key); err != nil || key.Type != "service_account" {
+		return "", fmt.Errorf("%s: not a service account key", keyFile)
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("%s: bad private key", keyFile)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", keyFile, err)
+	}
+	rsaKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("%s: private key is not RSA", keyFile)
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	now := time.Now().Unix()
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   key.ClientEmail,
+		"scope": scope,
+		"aud":   key.TokenURI,
+		"iat":   now,
+		"exp":   now + 3600,
+	})
+	signed := header + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	assertion := signed + "." + enc.EncodeToString(sig)
+
+	resp, err := httpClient.PostForm(key.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", fmt.Errorf("google token: %w", err)
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error_description"`
+	}
+	json.NewDecoder(resp.Body).Decode(&tok)
+	if resp.StatusCode != http.StatusOK || tok.AccessToken == "" {
+		return "", fmt.Errorf("google token failed: %s %s", resp.Status, tok.Error)
+	}
+	return tok.AccessToken, nil
+}
+
+// googleChunkSize rounds -part-size up to the resumable upload granularity.
+func googleChunkSize() int64 {
+	return (max(int64(partSize), googleChunkAlign) + googleChunkAlign - 1) / googleChunkAlign * googleChunkAlign
+}
+
+// resumableUpload sends file over a Google resumable upload session (GCS and
+// Drive speak the same protocol). Chunks go in order, so -upload-parallel
+// doesn't apply; on -resume the saved session is asked how much it already
+// has. start opens a new session and returns its URI.
+func resumableUpload(st *uploadState, file string, prog *stageProgress, start func() (string, error)) error {
+	var offset int64
+	if st.Session != "" {
+		off, err := resumableOffset(st.Session, st.Size)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Cannot resume %s, starting over: %v\n", file, err)
+			st.Session = ""
+		} else if off == st.Size {
+			prog.add(st.Size)
+			st.remove()
+			return nil
+		} else {
+			offset = off
+		}
+	}
+	if st.Session == "" {
+		session, err := start()
+		if err != nil {
+			return err
+		}
+		st.Session = session
+		if err := st.save(); err != nil {
+			return err
+		}
+	}
+	prog.add(offset)
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	failed := false
+	for {
+		err := withRetry(fmt.Sprintf("upload %s at %d", file, offset), func() error {
+			if failed {
+				// Part of the failed chunk may have been persisted.
+				off, err := resumableOffset(st.Session, st.Size)
+				if err != nil {
+					return err
+				}
+				prog.add(off - offset)
+				offset, failed = off, false
+			}
+			n := min(st.PartSize, st.Size-offset)
+			next, err := resumablePutChunk(st.Session, io.NewSectionReader(f, offset, n), offset, n, st.Size)
+			if err != nil {
+				failed = true
+				return err
+			}
+			prog.add(next - offset)
+			offset = next
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if offset >= st.Size {
+			break
+		}
+	}
+	st.remove()
+	return nil
+}
+
+// resumablePutChunk sends bytes [offset, offset+n) and returns the offset the
+// server has persisted up to.
+func resumablePutChunk(session string, r io.Reader, offset, n, total int64) (int64, error) {
+	req, err := http.NewRequest(http.MethodPut, session, r)
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = n
+	if n == 0 {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", total))
+	} else {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+n-1, total))
+	}
+	return resumableDo(req, total)
+}
+
+func resumableOffset(session string, total int64) (int64, error) {
+	req, err := http.NewRequest(http.MethodPut, session, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", total))
+	return resumableDo(req, total)
+}
+
+// resumableDo interprets a resumable upload response: 200/201 means complete,
+// 308 reports the persisted range.
+func resumableDo(req *http.Request, total int64) (int64, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("upload: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return total, nil
+	case http.StatusPermanentRedirect:
+		// Range: bytes=0-N
+		r := resp.Header.Get("Range")
+		if r == "" {
+			return 0, nil
+		}
+		_, end, _ := strings.Cut(r, "-")
+		n, err := strconv.ParseInt(end, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("upload: bad Range header %q", r)
+		}
+		return n + 1, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return 0, fmt.Errorf("upload failed: %s\n%s", resp.Status, msg)
+}
+
+// startResumable opens a resumable session with an initial request carrying
+// optional JSON metadata and returns the session URI from Location.
+func startResumable(method, u, token string, size int64, metadata any) (string, error) {
+	var body io.Reader
+	if metadata != nil {
+		data, err := json.Marshal(metadata)
+		if err != nil {
+			return "", err
+		}
+		body = strings.NewReader(string(data))
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+	if metadata != nil {
+		req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("start upload: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Location") == "" {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("start upload failed: %s\n%s", resp.Status, msg)
+	}
+	return resp.Header.Get("Location"), nil
+}
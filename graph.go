@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OneDrive and SharePoint targets go through Microsoft Graph:
+//
+//	onedrive://me/folder                        (the signed-in user's drive)
+//	onedrive://<drive ID>/folder
+//	sharepoint://contoso.sharepoint.com/sites/Releases/Documents/folder
+//
+// The token is the target credential's password, GRAPH_TOKEN, a client
+// credentials grant with AZURE_TENANT_ID/AZURE_CLIENT_ID/AZURE_CLIENT_SECRET,
+// or `az account get-access-token`.
+
+var (
+	graphAPI   = "https://graph.microsoft.com/v1.0"
+	graphLogin = "https://login.microsoftonline.com"
+)
+
+const (
+	// Upload session fragments must be multiples of 320 KiB, at most 60 MiB.
+	graphChunkAlign = 320 << 10
+	graphMaxChunk   = 60 << 20
+)
+
+func isGraph(p string) bool {
+	return strings.HasPrefix(p, "onedrive://") || strings.HasPrefix(p, "sharepoint://")
+}
+
+func graphToken(explicit string) (string, error) {
+	if explicit != "" {
+		return explicit, nil
+	}
+	if t := os.Getenv("GRAPH_TOKEN"); t != "" {
+		return t, nil
+	}
+	if tenant, id := os.Getenv("AZURE_TENANT_ID"), os.Getenv("AZURE_CLIENT_ID"); tenant != "" && id != "" {
+		resp, err := httpClient.PostForm(graphLogin+"/"+url.PathEscape(tenant)+"/oauth2/v2.0/token", url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {id},
+			"client_secret": {os.Getenv("AZURE_CLIENT_SECRET")},
+			"scope":         {"https://graph.microsoft.com/.default"},
+		})
+		if err != nil {
+			return "", fmt.Errorf("graph token: %w", err)
+		}
+		defer resp.Body.Close()
+		var tok struct {
+			AccessToken string `json:"access_token"`
+			Error       string `json:"error_description"`
+		}
+		json.NewDecoder(resp.Body).Decode(&tok)
+		if resp.StatusCode != http.StatusOK || tok.AccessToken == "" {
+			return "", fmt.Errorf("graph token failed: %s %s", resp.Status, tok.Error)
+		}
+		return tok.AccessToken, nil
+	}
+	out, err := commandOutput(cloudCommand("az", "account", "get-access-token", "--resource-type", "ms-graph", "--query", "accessToken", "-o", "tsv"))
+	if err != nil {
+		return "", fmt.Errorf("no Microsoft Graph credentials: set GRAPH_TOKEN or AZURE_TENANT_ID/AZURE_CLIENT_ID/AZURE_CLIENT_SECRET, or log in with az (%s)", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// graphItemURL returns the Graph URL of the drive item name under dest, in
+// the /drives/{id}/root:/{path}: form.
+func graphItemURL(dest, name, token string) (string, error) {
+	var drive, folder string
+	if rest, ok := strings.CutPrefix(dest, "onedrive://"); ok {
+		id, f, _ := strings.Cut(rest, "/")
+		if id == "me" {
+			drive = "/me/drive"
+		} else {
+			drive = "/drives/" + url.PathEscape(id)
+		}
+		folder = f
+	} else {
+		var err error
+		if drive, folder, err = sharePointDrive(strings.TrimPrefix(dest, "sharepoint://"), token); err != nil {
+			return "", err
+		}
+	}
+	p := strings.TrimPrefix(path.Join("/", folder, name), "/")
+	return graphAPI + drive + "/root:/" + (&url.URL{Path: p}).EscapedPath() + ":", nil
+}
+
+// sharePointDrive resolves host/sites/site/Library/folder to the library's
+// drive and the folder within it.
+func sharePointDrive(p, token string) (string, string, error) {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	if len(parts) < 4 || parts[1] != "sites" {
+		return "", "", fmt.Errorf("invalid SharePoint target %q (want sharepoint://host/sites/site/Library/folder)", p)
+	}
+	var site struct {
+		ID string `json:"id"`
+	}
+	if err := graphGet(graphAPI+"/sites/"+parts[0]+":/sites/"+url.PathEscape(parts[2]), token, &site); err != nil {
+		return "", "", err
+	}
+	var drives struct {
+		Value []struct {
+			ID     string `json:"id"`
+			Name   string `json:"name"`
+			WebURL string `json:"webUrl"`
+		} `json:"value"`
+	}
+	if err := graphGet(graphAPI+"/sites/"+site.ID+"/drives", token, &drives); err != nil {
+		return "", "", err
+	}
+	library := parts[3]
+	for _, d := range drives.Value {
+		// The URL segment ("Shared Documents") and display name
+		// ("Documents") of a library often differ; accept either.
+		seg, _ := url.PathUnescape(path.Base(d.WebURL))
+		if strings.EqualFold(d.Name, library) || strings.EqualFold(seg, library) {
+			return "/drives/" + d.ID, strings.Join(parts[4:], "/"), nil
+		}
+	}
+	return "", "", fmt.Errorf("sharepoint: no document library %q in site %s", library, parts[2])
+}
+
+func graphGet(u, token string, v any) error {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if err := doJSON(req, v); err != nil {
+		return fmt.Errorf("graph: %w", err)
+	}
+	return nil
+}
+
+// uploadGraph uploads file with a Graph upload session, replacing an
+// existing file. Fragments are sent in order; on -resume the session reports
+// which ranges it still expects.
+func uploadGraph(dest, file, token string, prog *stageProgress) error {
+	token, err := graphToken(token)
+	if err != nil {
+		return err
+	}
+	item, err := graphItemURL(dest, filepath.Base(file), token)
+	if err != nil {
+		return err
+	}
+	chunk := min(max(int64(partSize)/graphChunkAlign, 1)*graphChunkAlign, graphMaxChunk)
+	st, err := loadUploadState(file, item, chunk)
+	if err != nil {
+		return err
+	}
+	if st.Size == 0 {
+		// Upload sessions can't be empty.
+		req, err := http.NewRequest(http.MethodPut, item+"/content", http.NoBody)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return doJSON(req, &struct{}{})
+	}
+
+	var offset int64
+	if st.Session != "" {
+		if offset, err = graphSessionOffset(st.Session); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Cannot resume %s, starting over: %v\n", file, err)
+			st.Session = ""
+		}
+	}
+	if st.Session == "" {
+		offset = 0
+		body := strings.NewReader(`{"item":{"@microsoft.graph.conflictBehavior":"replace"}}`)
+		req, err := http.NewRequest(http.MethodPost, item+"/createUploadSession", body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		var session struct {
+			UploadURL string `json:"uploadUrl"`
+		}
+		if err := doJSON(req, &session); err != nil {
+			return fmt.Errorf("graph: %w", err)
+		}
+		st.Session = session.UploadURL
+		if err := st.save(); err != nil {
+			return err
+		}
+	}
+	prog.add(offset)
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	failed := false
+	for offset < st.Size {
+		err := withRetry(fmt.Sprintf("upload %s at %d", file, offset), func() error {
+			if failed {
+				off, err := graphSessionOffset(st.Session)
+				if err != nil {
+					return err
+				}
+				prog.add(off - offset)
+				offset, failed = off, false
+				if offset >= st.Size {
+					return nil
+				}
+			}
+			n := min(st.PartSize, st.Size-offset)
+			// The upload URL is pre-authenticated; no Authorization header.
+			req, err := http.NewRequest(http.MethodPut, st.Session, io.NewSectionReader(f, offset, n))
+			if err != nil {
+				return err
+			}
+			req.ContentLength = n
+			req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+n-1, st.Size))
+			resp, err := httpClient.Do(req)
+			if err != nil {
+				failed = true
+				return fmt.Errorf("graph upload: %w", err)
+			}
+			defer resp.Body.Close()
+			switch resp.StatusCode {
+			case http.StatusOK, http.StatusCreated, http.StatusAccepted:
+				prog.add(n)
+				offset += n
+				return nil
+			}
+			failed = true
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			return fmt.Errorf("graph upload failed: %s\n%s", resp.Status, msg)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	st.remove()
+	return nil
+}
+
+// graphSessionOffset asks an upload session for the first byte it still
+// expects.
+func graphSessionOffset(session string) (int64, error) {
+	req, err := http.NewRequest(http.MethodGet, session, nil)
+	if err != nil {
+		return 0, err
+	}
+	var status struct {
+		NextExpectedRanges []string `json:"nextExpectedRanges"`
+	}
+	if err := doJSON(req, &status); err != nil {
+		return 0, fmt.Errorf("graph: %w", err)
+	}
+	if len(status.NextExpectedRanges) == 0 {
+		return 0, fmt.Errorf("graph: upload session has no pending ranges")
+	}
+	start, _, _ := strings.Cut(status.NextExpectedRanges[0], "-")
+	return strconv.ParseInt(start, 10, 64)
+}
+
+func graphStat(dest, name, token string) (int64, time.Time, error) {
+	token, err := graphToken(token)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	item, err := graphItemURL(dest, name, token)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	var meta struct {
+		Size         int64     `json:"size"`
+		LastModified time.Time `json:"lastModifiedDateTime"`
+	}
+	err = graphGet(item, token, &meta)
+	return meta.Size, meta.LastModified, err
+}
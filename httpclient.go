@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// httpClient is shared by everything that talks HTTP (secret backends,
+// upload targets). Its transport honors HTTPS_PROXY, HTTP_PROXY and NO_PROXY,
+// or -proxy when set.
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+// transport returns httpClient's transport, cloned from the default one the
+// first time so -proxy and the TLS options can each adjust it.
+func transport() *http.Transport {
+	if t, ok := httpClient.Transport.(*http.Transport); ok {
+		return t
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	httpClient.Transport = t
+	return t
+}
+
+// proxyEnv holds the proxy variables for the cloud CLIs zipper runs (aws,
+// gcloud, az), which need -proxy too. Other commands (gpg, robocopy, ssh,
+// run-all's jobs...) don't get them, so a resolved -proxy-pass stays out of
+// their environment.
+var proxyEnv []string
+
+var proxyCLIs = []string{"aws", "gcloud", "az"}
+
+// setupProxy applies -proxy to httpClient and the cloud CLIs. NO_PROXY still
+// applies. -proxy-user/-proxy-pass supply credentials not in the URL.
+func setupProxy() error {
+	if proxyURL == "" {
+		return nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid -proxy %q: want http://host:port", proxyURL)
+	}
+	if proxyUser != "" {
+		pass, err := resolveSecret(proxyPass, proxyUser)
+		if err != nil {
+			return fmt.Errorf("proxy password: %w", err)
+		}
+		u.User = url.UserPassword(proxyUser, pass)
+	}
+	if pass, ok := u.User.Password(); ok {
+		addSecret(pass)
+	}
+	transport().Proxy = func(req *http.Request) (*url.URL, error) {
+		if noProxy(req.URL.Hostname()) {
+			return nil, nil
+		}
+		return u, nil
+	}
+	// The CLIs can only take proxy credentials in the URL.
+	for _, name := range []string{"HTTPS_PROXY", "HTTP_PROXY", "https_proxy", "http_proxy"} {
+		proxyEnv = append(proxyEnv, name+"="+u.String())
+	}
+	return nil
+}
+
+// cloudCommand is exec.Command for a cloud CLI, with -proxy in its
+// environment.
+func cloudCommand(name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.Env = commandEnv(name)
+	return cmd
+}
+
+// commandEnv is the environment to run name with: the proxy variables for a
+// cloud CLI when -proxy is set, nil (zipper's own) otherwise.
+func commandEnv(name string) []string {
+	if proxyEnv == nil || !slices.Contains(proxyCLIs, name) {
+		return nil
+	}
+	return append(os.Environ(), proxyEnv...)
+}
+
+// noProxy reports whether NO_PROXY exempts host: "*", a host name or domain
+// (with or without a leading dot), an IP address or a CIDR range.
+func noProxy(host string) bool {
+	list := os.Getenv("NO_PROXY")
+	if list == "" {
+		list = os.Getenv("no_proxy")
+	}
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		switch {
+		case entry == "":
+		case entry == "*":
+			return true
+		case ip != nil:
+			if _, cidr, err := net.ParseCIDR(entry); err == nil && cidr.Contains(ip) {
+				return true
+			}
+			if ip.Equal(net.ParseIP(entry)) {
+				return true
+			}
+		default:
+			domain := strings.TrimPrefix(entry, ".")
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
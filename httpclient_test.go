@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSetupProxy(t *testing.T) {
+	var seen []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.URL.String()+" "+r.Header.Get("Proxy-Authorization"))
+	}))
+	defer proxy.Close()
+	defer func() { proxyURL, proxyUser, proxyPass, proxyEnv, httpClient.Transport = "", "", "", nil, nil }()
+	proxyURL, proxyUser, proxyPass = proxy.URL, "builder", "s3cret"
+	t.Setenv("NO_PROXY", "internal.example,10.0.0.0/8")
+	t.Setenv("HTTPS_PROXY", "")
+
+	if err := setupProxy(); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := httpClient.Get("http://downloads.example/app.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(seen) != 1 || !strings.HasPrefix(seen[0], "http://downloads.example/app.zip Basic ") {
+		t.Errorf("proxy saw %q, want the request with credentials", seen)
+	}
+
+	for _, host := range []string{"internal.example", "repo.internal.example", "10.1.2.3"} {
+		if !noProxy(host) {
+			t.Errorf("NO_PROXY doesn't exempt %s", host)
+		}
+	}
+	if noProxy("example") {
+		t.Error("NO_PROXY exempts example")
+	}
+
+	// The password reaches the cloud CLIs only.
+	if os.Getenv("HTTPS_PROXY") != "" {
+		t.Error("HTTPS_PROXY set in zipper's own environment")
+	}
+	if commandEnv("gpg") != nil {
+		t.Error("gpg gets the proxy environment")
+	}
+	if env := commandEnv("aws"); !slices.ContainsFunc(env, func(v string) bool { return strings.HasPrefix(v, "HTTPS_PROXY=") && strings.Contains(v, "s3cret") }) {
+		t.Error("aws doesn't get HTTPS_PROXY")
+	}
+}
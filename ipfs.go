@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IPFS targets (experimental) are written ipfs:// for the node in IPFS_API
+// (default 127.0.0.1:5001) or ipfs://host:port. The zip is added and pinned
+// through the node's HTTP API before the manifest is written, so the CID can
+// be recorded in it.
+
+func isIPFS(p string) bool {
+	return strings.HasPrefix(p, "ipfs://")
+}
+
+func ipfsAPI(p string) string {
+	api := strings.TrimPrefix(p, "ipfs://")
+	if api == "" {
+		api = os.Getenv("IPFS_API")
+	}
+	if api == "" {
+		api = "127.0.0.1:5001"
+	}
+	if !strings.Contains(api, "://") {
+		api = "http://" + api
+	}
+	return strings.TrimRight(api, "/")
+}
+
+// ipfsAdd adds file to the node at target p and returns its CID (v1).
+func ipfsAdd(p, file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	prog := startProgress("ipfs", fileSize(file))
+	defer prog.finish()
+	prog.setFile(filepath.Base(file))
+
+	pr, pw := io.Pipe()
+	// Closing the read end unblocks the writer when the request fails
+	// before the body was read.
+	defer pr.Close()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreateFormFile("file", filepath.Base(file))
+		if err == nil {
+			_, err = io.Copy(part, io.TeeReader(f, prog))
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	resp, err := httpClient.Post(ipfsAPI(p)+"/api/v0/add?cid-version=1&pin=true&quieter=true",
+		mw.FormDataContentType(), pr)
+	if err != nil {
+		return "", fmt.Errorf("ipfs add failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("ipfs add failed: %s\n%s", resp.Status, msg)
+	}
+	var added struct{ Hash string }
+	if err := json.NewDecoder(resp.Body).Decode(&added); err != nil || added.Hash == "" {
+		return "", fmt.Errorf("ipfs add: unexpected response")
+	}
+	return added.Hash, nil
+}
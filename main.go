@@ -4,266 +4,1196 @@ import (
 	"archive/zip"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
-	srcPath        string
-	targetZip      string
-	writeHash      bool
-	gpgSign        bool
-	copyTo         string
-	netUser        string
-	netPass        string
-	useRobocopy    bool
-	verifyOnTarget bool
-	dryRun         bool
+	srcPath           string
+	targetZip         string
+	writeHash         bool
+	gpgSign           bool
+	copyTo            string
+	netUser           string
+	netPass           string
+	useRobocopy       bool
+	verifyOnTarget    bool
+	dryRun            bool
+	excludes          stringList
+	excludeMatch      string
+	presets           stringList
+	listExcluded      string
+	minFree           byteSize
+	cmdTimeout        time.Duration
+	recordXattrs      bool
+	aclSidecar        bool
+	splitByDir        bool
+	packInto          int
+	packMaxSize       byteSize
+	verifySource      string
+	retries           int
+	retryWait         time.Duration
+	progressFormat    string
+	progressOut       string
+	statusSocket      string
+	ghaMode           bool
+	fileHashes        bool
+	writeChain        bool
+	keepPrevious      int
+	prefetchWorkers   int
+	walkWorkers       int
+	useMmap           bool
+	directIO          bool
+	lowPriority       bool
+	dropCache         bool
+	maxCPU            string
+	configPath        string
+	signPassphrase    string
+	signerName        string
+	signKey           string
+	signAlg           string
+	writeManifestFile bool
+	pkcs11Module      string
+	pkcs11Slot        string
+	pkcs11Pin         string
+	signFormat        string
+	rekorPublish      bool
+	rekorURL          string
+	rekorPubKey       string
+	resumeUpload      bool
+	partSize          = byteSize(64 << 20)
+	uploadParallel    int
+	verifyMode        string
+	remoteAttrs       string
+	nfsOpts           string
+	authMode          string
+	proxyURL          string
+	proxyUser         string
+	proxyPass         string
+	tlsCert           string
+	tlsKey            string
+	tlsCA             string
+	sshKey            string
+	sshKnownHosts     string
+	sshHostKey        string
+	sshTOFU           bool
+	netDomain         string
+	keytab            string
+	aclGrants         stringList
+	fileModeSpec      string
+	reportFormat      string
+	reportUpload      bool
+	makeTorrent       bool
+	torrentTrackers   stringList
+	torrentWebSeeds   stringList
+	torrentPieceSize  byteSize
+	makeZsync         bool
+	zsyncURL          string
 )
 
 func init() {
 	flag.StringVar(&srcPath, "src", "", "Source file or directory to zip")
 	flag.StringVar(&targetZip, "out", "output.zip", "Output zip file name")
+	flag.BoolVar(&splitByDir, "split-by-dir", false, "Make one zip per top-level directory of -src, named <out>-<dir>.zip")
+	flag.IntVar(&packInto, "pack-into", 0, "Spread the files over this many zips of about equal size, named <out>-partN-of-M.zip")
+	flag.Var(&packMaxSize, "pack-max-size", "Spread the files over as many zips as needed to keep each under this uncompressed size, e.g. 4GiB")
 	flag.BoolVar(&writeHash, "hash", false, "Write SHA256 hash of zip file")
 	flag.BoolVar(&gpgSign, "sign", false, "Sign the SHA256 file using GPG")
+	flag.StringVar(&signerName, "signer", "gpg", "Signer for -sign: gpg, aws-kms, azure-kv, gcp-kms or pkcs11")
+	flag.StringVar(&signFormat, "sign-format", "armor", "GPG signature form: armor (.asc), binary (detached .sig) or clearsign (clear-signed .asc)")
+	flag.StringVar(&signKey, "sign-key", "", "Signing key: GPG user ID, AWS KMS key ID/ARN, Azure Key Vault key ID, GCP KMS key version name or PKCS#11 key label (id:<hex> for an ID)")
+	flag.StringVar(&signAlg, "sign-alg", "", "KMS signing algorithm (default RSASSA_PKCS1_V1_5_SHA_256 for AWS, RS256 for Azure)")
+	flag.StringVar(&pkcs11Module, "pkcs11-module", "", "PKCS#11 module for -signer pkcs11, e.g. /usr/lib/opensc-pkcs11.so")
+	flag.StringVar(&pkcs11Slot, "pkcs11-slot", "", "PKCS#11 slot ID (default 0)")
+	flag.StringVar(&pkcs11Pin, "pkcs11-pin", "", "PKCS#11 user PIN or secret reference (env:, keyring:, dpapi:, vault:...)")
+	flag.StringVar(&reportFormat, "report", "", "Write a release report: md, html or json")
+	flag.BoolVar(&reportUpload, "report-upload", false, "Copy the release report to the targets")
+	flag.BoolVar(&makeTorrent, "torrent", false, "Write a .torrent for the zip")
+	flag.Var(&torrentTrackers, "torrent-tracker", "Tracker announce URL for -torrent (repeatable)")
+	flag.Var(&torrentWebSeeds, "torrent-webseed", "HTTP web seed URL for -torrent, e.g. the upload target (repeatable)")
+	flag.Var(&torrentPieceSize, "torrent-piece-size", "Torrent piece size (default: automatic)")
+	flag.BoolVar(&makeZsync, "zsync", false, "Write a .zsync with block checksums so clients holding an older release download only changed blocks")
+	flag.StringVar(&zsyncURL, "zsync-url", "", "URL of the zip recorded in the .zsync (default: its name, relative to the .zsync)")
+	flag.BoolVar(&rekorPublish, "rekor", false, "Publish the signature to a Rekor transparency log and record it in the manifest")
+	flag.StringVar(&rekorURL, "rekor-url", "https://rekor.sigstore.dev", "Rekor server for -rekor")
+	flag.StringVar(&rekorPubKey, "rekor-pubkey", "", "PEM public key of the KMS/PKCS#11 signing key for -rekor")
+	flag.BoolVar(&writeManifestFile, "manifest", false, "Write <out>.manifest.json describing the artifact, its hash and signatures")
+	flag.BoolVar(&writeChain, "chain", false, "Write and sign <out>.chain.json linking the source tree, archive, signature and upload locations, for \"zipper audit\" (needs -hash and -sign)")
+	flag.StringVar(&signPassphrase, "sign-passphrase", "", "GPG key passphrase or secret reference (env:, keyring:, dpapi:, vault:...)")
 	flag.StringVar(&copyTo, "copyto", "", "UNC path to copy files to")
 	flag.StringVar(&netUser, "user", "", "Username for network share")
 	flag.StringVar(&netPass, "pass", "", "Password for network share")
+	flag.StringVar(&netDomain, "domain", "", "Domain for -user and credentials without one, sent as DOMAIN\\user")
+	flag.StringVar(&authMode, "auth", "negotiate", "SMB authentication: ntlm, kerberos or negotiate")
+	flag.StringVar(&keytab, "keytab", "", "Keytab to get a Kerberos ticket for -user from before mounting SMB targets (Linux, implies -auth kerberos)")
 	flag.BoolVar(&useRobocopy, "useRobocopy", false, "Use robocopy instead of regular copy")
+	flag.IntVar(&keepPrevious, "keep-previous", 0, "On file and UNC targets, move artifacts being replaced to _previous/<time>/ and keep this many such folders (0: overwrite)")
+	flag.StringVar(&proxyURL, "proxy", "", "HTTP(S) proxy for cloud targets and other HTTP traffic, e.g. http://proxy:3128 (default from HTTPS_PROXY)")
+	flag.StringVar(&proxyUser, "proxy-user", "", "Proxy username")
+	flag.StringVar(&proxyPass, "proxy-pass", "", "Proxy password or secret reference (env:, keyring:, dpapi:, vault:...)")
+	flag.StringVar(&tlsCert, "tls-cert", "", "PEM client certificate for HTTPS targets that require mutual TLS")
+	flag.StringVar(&tlsKey, "tls-key", "", "PEM private key for -tls-cert")
+	flag.StringVar(&tlsCA, "tls-ca", "", "PEM bundle of extra CAs to trust for HTTPS targets")
+	flag.StringVar(&sshKey, "ssh-key", "", "Private key for sftp:// and scp:// targets (default: ssh agent and ~/.ssh)")
+	flag.StringVar(&sshKnownHosts, "ssh-known-hosts", "", "known_hosts file to check SSH host keys against (default ~/.ssh/known_hosts)")
+	flag.StringVar(&sshHostKey, "ssh-host-key", "", "Pinned SHA256 host key fingerprint for SSH targets, as ssh-keygen -l prints it")
+	flag.BoolVar(&sshTOFU, "ssh-tofu", false, "Trust an SSH host's key on first use and add it to known_hosts")
+	flag.BoolVar(&resumeUpload, "resume", false, "Save cloud upload progress, and resume interrupted uploads from it")
+	flag.Var(&partSize, "part-size", "Part size for cloud uploads, e.g. 64MiB")
+	flag.IntVar(&uploadParallel, "upload-parallel", 4, "Parts uploaded concurrently to S3 and Azure")
 	flag.BoolVar(&verifyOnTarget, "verifyTarget", false, "Verify SHA256 after copy")
+	flag.StringVar(&nfsOpts, "nfs-opts", "", "Mount options for nfs:// targets, e.g. vers=4.1")
+	flag.StringVar(&remoteAttrs, "remote-attrs", "", "Attributes to set on copied files: readonly, archive")
+	flag.Var(&aclGrants, "acl", "Grant rights on copied files with icacls, e.g. CORP\\consumers:R (repeatable)")
+	flag.BoolVar(&aclSidecar, "acl-sidecar", false, "Store the source files' ACLs (SDDL) in the archive for \"zipper acl restore\" (Windows)")
+	flag.StringVar(&fileModeSpec, "file-mode", "", "POSIX mode for copied files, e.g. 0444")
+	flag.StringVar(&verifyMode, "verify-mode", "full", "Target verification: full (re-hash) or quick (size and mtime)")
+	flag.BoolVar(&recordXattrs, "xattrs", false, "Record extended attributes / alternate data streams of archived files in <out>.xattrs.json")
+	flag.StringVar(&verifySource, "verify-source", "", "After zipping, re-hash source files and compare with what was archived: all, a share (10%) or a number of files")
+	flag.BoolVar(&fileHashes, "file-hashes", false, "Write SHA256 of every archived file to <out>.files.sha256")
+	flag.IntVar(&prefetchWorkers, "prefetch", 4, "Number of readers prefetching small files ahead of the compressor")
+	flag.IntVar(&walkWorkers, "walk-workers", 8, "Number of directories listed concurrently while collecting source files")
+	flag.BoolVar(&useMmap, "mmap", false, "Memory-map large input files instead of buffered reads (64-bit only)")
+	flag.Var(&minFree, "min-free", "Abort the zip and delete it if free space on the output volume drops below this, e.g. 1GiB")
+	flag.BoolVar(&directIO, "direct-io", false, "Bypass the OS page cache when reading large sources and writing the zip")
+	flag.BoolVar(&lowPriority, "low-priority", false, "Run with background CPU and I/O priority so interactive workloads aren't starved")
+	flag.BoolVar(&dropCache, "drop-cache", false, "Drop source files from the OS page cache once archived, and the zip and its sidecars at the end of the run (Linux, Windows)")
+	flag.StringVar(&maxCPU, "max-cpu", "", "Limit CPU usage to a share of all cores, e.g. 50%")
+	flag.StringVar(&configPath, "config", "", "YAML config with publish targets and their credentials")
 	flag.BoolVar(&dryRun, "dryrun", false, "Simulate all actions without file creation or copy")
+	flag.Var(&excludes, "exclude", "Glob pattern to exclude from the zip (repeatable)")
+	flag.Var(&firstPatterns, "first", "Glob pattern of files to put first in the zip, stored uncompressed for streaming readers (repeatable, in order)")
+	flag.StringVar(&excludeMatch, "exclude-match", "path", "How -exclude patterns match: path (any depth), base (file name only) or anchored (from source root)")
+	flag.IntVar(&retries, "retries", 3, "Retries for reading the source and copying files")
+	flag.DurationVar(&cmdTimeout, "cmd-timeout", 0, "Kill gpg, net use, robocopy and certutil if they run longer than this, e.g. 30m (default: no limit)")
+	flag.DurationVar(&retryWait, "retry-wait", 2*time.Second, "Initial wait between retries, doubled after each attempt")
+	flag.StringVar(&progressFormat, "progress-format", "bar", "Progress output: bar, json (newline-delimited events) or none")
+	flag.StringVar(&progressOut, "progress-out", "", "File or named pipe for -progress-format json, or - for stdout (default stderr)")
+	flag.StringVar(&statusSocket, "status-socket", "", "Serve the running job's status as JSON on this unix socket, or named pipe (\\\\.\\pipe\\name) on Windows")
+	flag.BoolVar(&ghaMode, "gha", false, "GitHub Actions mode: log groups, error annotations and step outputs")
+	flag.Var(&presets, "preset", "Exclude preset: node, dotnet, python or git (repeatable or comma separated)")
+	flag.StringVar(&listExcluded, "list-excluded", "", "Write each path skipped by -exclude/-preset, and the rule that matched, to this file")
 }
 
 func main() {
+	setupConsole()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "checksum":
+			os.Exit(runChecksum(os.Args[2:]))
+		case "dpapi":
+			os.Exit(runDPAPI(os.Args[2:]))
+		case "schedule":
+			os.Exit(runSchedule(os.Args[2:]))
+		case "xattrs":
+			os.Exit(runXattrs(os.Args[2:]))
+		case "acl":
+			os.Exit(runACL(os.Args[2:]))
+		case "serve":
+			os.Exit(runServe(os.Args[2:]))
+		case "reencrypt":
+			os.Exit(runReencrypt(os.Args[2:]))
+		case "audit":
+			os.Exit(runAudit(os.Args[2:]))
+		case "fetch":
+			os.Exit(runFetch(os.Args[2:]))
+		case "prune":
+			os.Exit(runPrune(os.Args[2:]))
+		case "run-all":
+			os.Exit(runAll(os.Args[2:]))
+		}
+	}
+
 	flag.Parse()
 	if srcPath == "" {
 		fmt.Println("❌ Please provide -src")
 		os.Exit(1)
 	}
+	setupCancel()
+	if lowPriority {
+		if err := setLowPriority(); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Cannot lower priority: %v\n", err)
+		}
+	}
+	if err := setupProxy(); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if err := setupTLS(); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if err := buildExcludeRules(excludes, excludeMatch); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if err := addExcludePresets(presets); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if err := validateFirst(); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if maxCPU != "" {
+		if err := applyMaxCPU(maxCPU); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := validateSigner(); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if err := validateChain(); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if err := parseRemoteAttrs(remoteAttrs); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if err := validateVerifySource(); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if err := validatePacking(); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if err := validateACLs(); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if err := validateAuth(); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if err := validateReport(); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if err := validateVerifyMode(); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if err := validateRekor(); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if keepPrevious < 0 {
+		fmt.Println("❌ -keep-previous can't be negative")
+		os.Exit(1)
+	}
+	if useMmap && directIO {
+		fmt.Println("❌ -mmap and -direct-io can't be combined")
+		os.Exit(1)
+	}
+	if err := initProgress(); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	// The JSON report lists the external commands run, so a failed run can
+	// be diagnosed from the report alone.
+	logCommands = reportFormat == "json" && !dryRun
+	addSecret(netPass)
+	if statusSocket != "" && dryRun {
+		fmt.Printf("[DRYRUN] Would serve status on %s\n", statusSocket)
+	} else if statusSocket != "" {
+		if err := startStatus(statusSocket); err != nil {
+			fmt.Printf("❌ cannot listen on -status-socket: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	var cfg *config
+	if configPath != "" {
+		var err error
+		if cfg, err = loadConfig(configPath); err != nil {
+			fmt.Printf("❌ Config error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	targets := publishTargets(cfg)
+
+	// Connect to a network source
+	if isUNC(srcPath) {
+		share := uncShareRoot(srcPath)
+		if dryRun {
+			dryRunConnect(share, qualifyUser(netUser, netDomain))
+		} else {
+			if err := useShare(share, qualifyUser(netUser, netDomain), netPass); err != nil {
+				fail(stageErr(ErrZip, share, err))
+			}
+		}
+	}
+
+	artifacts, err := planArtifacts(srcPath, targetZip)
+	if err != nil {
+		fail(stageErr(ErrZip, srcPath, err))
+	}
+	started := 0
+	if reportFormat == "json" && !dryRun {
+		// A failed run still writes the reports of the artifacts it got to,
+		// with the error and the commands run.
+		atExit(func(code int) {
+			if code == 0 {
+				return
+			}
+			if runError == nil {
+				runError = fmt.Errorf("exited with code %d", code)
+			}
+			building := artifactManifest
+			for _, a := range artifacts[:started] {
+				artifactManifest = building
+				if a.outputs != nil {
+					artifactManifest = a.manifest
+				}
+				if err := writeReport(a.zip, a.hash, targets); err != nil {
+					fmt.Fprintf(os.Stderr, "⚠️  Cannot write release report: %v\n", err)
+				}
+			}
+		})
+	}
+	var filesToCopy []string
+	for i := range artifacts {
+		started = i + 1
+		if len(artifacts) > 1 {
+			setTimingTarget(filepath.Base(artifacts[i].zip))
+		}
+		buildArtifact(&artifacts[i], targets)
+		filesToCopy = append(filesToCopy, artifacts[i].outputs...)
+	}
+
+	// Copy and verify steps, once per target
+	for _, t := range targets {
+		if isIPFS(t.Path) {
+			continue
+		}
+		ghaGroup("Copy to " + redactURL(t.Path))
+		setTimingTarget(redactURL(t.Path))
+		cleanup := func() {}
+		if isNFSURL(t.Path) {
+			if dryRun {
+				fmt.Println("[DRYRUN] Would mount:", t.Path)
+			} else {
+				dir, err := mountNFS(t.Path)
+				if err != nil {
+					fail(stageErr(ErrCopy, t.Path, err))
+				}
+				cleanup = func() { unmountDir(dir) }
+				t.Path = dir
+			}
+		}
+		user, pass := "", ""
+		if t.Credential != "" && dryRun {
+			fmt.Printf("[DRYRUN] Would use credential %q for %s\n", t.Credential, t.Path)
+		} else {
+			var err error
+			user, pass, err = targetCredentials(cfg, t)
+			if err != nil {
+				cleanup()
+				fail(stageErr(ErrCopy, redactURL(t.Path), err))
+			}
+		}
+		if isUNC(t.Path) && runtime.GOOS != "windows" {
+			if dryRun {
+				fmt.Println("[DRYRUN] Would mount:", t.Path)
+			} else {
+				dir, p, err := mountSMB(t.Path, user, pass)
+				if err != nil {
+					cleanup()
+					fail(stageErr(ErrCopy, t.Path, err))
+				}
+				cleanup = func() { unmountDir(dir) }
+				t.Path = p
+			}
+		}
+		if keepPrevious > 0 && (isCloudTarget(t.Path) || isSSH(t.Path)) {
+			fmt.Fprintf(os.Stderr, "⚠️  -keep-previous only applies to file and UNC targets; overwriting on %s\n", redactURL(t.Path))
+		}
+		var err error
+		if isCloudTarget(t.Path) {
+			err = uploadToCloud(t.Path, filesToCopy, pass, dryRun)
+		} else if isSSH(t.Path) {
+			t.Path = sshWithUser(t.Path, user)
+			err = copyToSSH(t.Path, filesToCopy, dryRun)
+		} else {
+			// A DFS path may resolve to several replicas; try each in turn
+			// and verify against the one that took the copy.
+			for i, p := range dfsTargets(t.Path) {
+				if i > 0 {
+					fmt.Fprintf(os.Stderr, "⚠️  %s\nFailing over to %s\n", redactSecrets(err.Error()), p)
+				}
+				if p != t.Path {
+					fmt.Printf("DFS %s → %s\n", t.Path, p)
+				}
+				if t.Robocopy {
+					err = copyWithRobocopy(p, filesToCopy, user, pass, dryRun)
+				} else {
+					err = copyToWindowsShare(p, filesToCopy, user, pass, dryRun)
+				}
+				if err == nil {
+					t.Path = p
+					break
+				}
+			}
+		}
+		if err != nil {
+			cleanup()
+			fail(stageErr(ErrCopy, redactURL(t.Path), err))
+		}
+		if !dryRun {
+			fmt.Println("✅ Copy completed")
+		}
+		ghaEndGroup()
+
+		mode := verifyMode
+		if t.Verify && mode == "full" && (isCloudTarget(t.Path) && !isDropbox(t.Path) || isSSH(t.Path)) {
+			fmt.Fprintf(os.Stderr, "⚠️  Full verification isn't supported for cloud and SSH targets, using quick for %s\n", redactURL(t.Path))
+			mode = "quick"
+		}
+		if t.Verify && (writeHash || mode == "quick" || isDropbox(t.Path)) {
+			ghaGroup("Verify " + redactURL(t.Path))
+			for _, a := range artifacts {
+				if dryRun {
+					fmt.Printf("[DRYRUN] Would verify %s on %s (%s)\n", filepath.Base(a.zip), redactURL(t.Path), mode)
+					continue
+				}
+				prog := startProgress("verify", 0)
+				var err error
+				if mode == "quick" {
+					err = verifyQuick(t.Path, a.zip, pass)
+				} else if isDropbox(t.Path) {
+					err = verifyDropboxHash(t.Path, a.zip, pass)
+				} else {
+					err = verifyHashOnTarget(t.Path, a.zip)
+				}
+				if err == nil && mode == "full" {
+					prog.add(fileSize(a.zip))
+				}
+				prog.finish()
+				if err != nil {
+					ghaError(a.zip, err)
+					cleanup()
+					fail(stageErr(ErrVerify, redactURL(t.Path), err))
+				}
+				if mode == "quick" {
+					fmt.Println("✅ Remote file size verified successfully")
+				} else {
+					fmt.Println("✅ Remote file hash verified successfully")
+				}
+			}
+			ghaEndGroup()
+		}
+		cleanup()
+	}
+	setTimingTarget("")
+
+	// The archive was last read by the copies and verifications; keeping it
+	// cached would only push out the pages of other services.
+	if dropCache {
+		for _, a := range artifacts {
+			if dryRun {
+				fmt.Printf("[DRYRUN] Would drop %s and its sidecars from the page cache\n", a.zip)
+				continue
+			}
+			for _, f := range a.outputs {
+				if err := dropPageCache(f); err != nil {
+					fmt.Fprintf(os.Stderr, "⚠️  Cannot drop %s from the page cache: %v\n", f, err)
+				}
+			}
+		}
+	}
+
+	if !dryRun {
+		// Rewrite the local report now that the copy and verify timings
+		// are known; uploaded copies stop at the report step.
+		if reportFormat != "" {
+			for _, a := range artifacts {
+				artifactManifest = a.manifest
+				if err := writeReport(a.zip, a.hash, targets); err != nil {
+					fmt.Fprintf(os.Stderr, "⚠️  Cannot update release report: %v\n", err)
+				}
+			}
+		}
+		writeStepOutputs(artifacts)
+	}
+	exit(0)
+}
+
+// buildArtifact runs the zip, hash, torrent, sign, IPFS, manifest, chain and
+// report steps for one artifact, and lists the files to copy in a.outputs.
+func buildArtifact(a *artifact, targets []target) {
+	artifactManifest = manifest{}
 
 	// Zip step
+	ghaGroup("Zip " + filepath.Base(a.zip))
 	if dryRun {
-		fmt.Printf("[DRYRUN] Would zip %s → %s\n", srcPath, targetZip)
+		fmt.Printf("[DRYRUN] Would zip %s → %s\n", a.src, a.zip)
+		if fileHashes {
+			fmt.Printf("[DRYRUN] Would write per-file SHA256 → %s\n", a.zip+".files.sha256")
+		}
+		if listExcluded != "" {
+			fmt.Printf("[DRYRUN] Would write excluded paths → %s\n", listExcluded)
+		}
+		if recordXattrs {
+			fmt.Printf("[DRYRUN] Would write extended attributes → %s\n", a.zip+".xattrs.json")
+		}
+		if aclSidecar {
+			fmt.Printf("[DRYRUN] Would store source ACLs in %s → %s\n", aclEntry, a.zip)
+		}
+		if verifySource != "" {
+			fmt.Printf("[DRYRUN] Would re-hash source files (%s) against %s\n", verifySource, a.zip)
+		}
 	} else {
-		err := zipFolder(srcPath, targetZip)
+		var err error
+		if a.files == nil {
+			err = zipFolder(srcPath, a.zip)
+		} else {
+			err = zipFiles(a.files, a.zip)
+		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "❌ Zip error: %v\n", err)
-			os.Exit(1)
+			fail(stageErr(ErrZip, a.src, err))
 		}
 		fmt.Println("✅ Zip completed")
 	}
+	ghaEndGroup()
 
 	// Hash step
 	if writeHash {
-		hashFile := targetZip + ".sha256"
+		ghaGroup("Hash")
+		hashFile := a.zip + ".sha256"
 		if dryRun {
 			fmt.Printf("[DRYRUN] Would generate SHA256 → %s\n", hashFile)
 		} else {
-			err := writeHashFile(targetZip)
+			var err error
+			a.hash, err = writeHashFile(a.zip)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "❌ Hash error: %v\n", err)
-				os.Exit(1)
+				ghaError(a.zip, err)
+				fail(stageErr(ErrHash, a.zip, err))
 			}
 			fmt.Println("✅ Hash file created")
 		}
+		ghaEndGroup()
+	}
+
+	// Torrent step
+	if makeTorrent {
+		if dryRun {
+			fmt.Printf("[DRYRUN] Would write torrent → %s\n", a.zip+".torrent")
+		} else {
+			infoHash, err := writeTorrent(a.zip)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "❌ Torrent error: %v\n", err)
+				exit(1)
+			}
+			artifactManifest.InfoHash = infoHash
+			fmt.Printf("✅ Torrent created (info hash %s)\n", infoHash)
+		}
+	}
+
+	// Zsync step
+	if makeZsync {
+		if dryRun {
+			fmt.Printf("[DRYRUN] Would write zsync block checksums → %s\n", a.zip+".zsync")
+		} else {
+			if err := writeZsync(a.zip); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ Zsync error: %v\n", err)
+				exit(1)
+			}
+			fmt.Println("✅ Zsync file created")
+		}
 	}
 
 	// Sign step
 	if gpgSign && writeHash {
-		sigFile := targetZip + ".sha256.asc"
+		ghaGroup("Sign")
+		sigFile := signatureFile(a.zip)
 		if dryRun {
-			fmt.Printf("[DRYRUN] Would sign %s → %s\n", targetZip+".sha256", sigFile)
+			signed := a.zip + ".sha256"
+			if signerName != "gpg" {
+				signed = a.zip
+			}
+			fmt.Printf("[DRYRUN] Would sign %s with %s → %s\n", signed, signerName, sigFile)
+			if rekorPublish {
+				fmt.Printf("[DRYRUN] Would log signature in Rekor at %s\n", rekorURL)
+			}
 		} else {
-			err := signWithGpg(targetZip + ".sha256")
+			prog := startProgress("sign", 0)
+			sig, err := signArtifact(a.zip, a.hash)
+			prog.finish()
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "❌ GPG sign error: %v\n", err)
-				os.Exit(1)
+				ghaError(a.zip+".sha256", err)
+				fail(stageErr(ErrSign, a.zip, err))
 			}
 			fmt.Println("✅ Signature file created")
+			if rekorPublish {
+				entry, err := publishRekor(a.zip, a.hash, sig)
+				if err != nil {
+					fail(stageErr(ErrSign, rekorURL, err))
+				}
+				sig.Rekor = entry
+				fmt.Printf("✅ Signature logged in Rekor (index %d, uuid %s)\n", entry.LogIndex, entry.UUID)
+			}
+			artifactManifest.Signatures = append(artifactManifest.Signatures, sig)
 		}
+		ghaEndGroup()
 	}
 
-	// File list to copy
-	filesToCopy := []string{targetZip}
-	if writeHash {
-		filesToCopy = append(filesToCopy, targetZip+".sha256")
-	}
-	if gpgSign && writeHash {
-		filesToCopy = append(filesToCopy, targetZip+".sha256.asc")
+	// IPFS step, ahead of the other targets so the CID is in the manifest
+	for _, t := range targets {
+		if !isIPFS(t.Path) {
+			continue
+		}
+		ghaGroup("Add to IPFS")
+		if dryRun {
+			fmt.Printf("[DRYRUN] Would add %s to IPFS node %s\n", a.zip, ipfsAPI(t.Path))
+		} else {
+			fmt.Fprintln(os.Stderr, "⚠️  IPFS publishing is experimental")
+			cid, err := ipfsAdd(t.Path, a.zip)
+			if err != nil {
+				ghaError(a.zip, err)
+				fail(stageErr(ErrCopy, ipfsAPI(t.Path), err))
+			}
+			artifactManifest.IPFS = cid
+			fmt.Printf("✅ Added to IPFS: %s\n", cid)
+		}
+		ghaEndGroup()
 	}
 
-	// Copy step
-	if copyTo != "" {
-		var err error
-		if useRobocopy {
-			err = copyWithRobocopy(copyTo, filesToCopy, netUser, netPass, dryRun)
+	// Manifest step
+	if writeManifestFile {
+		if dryRun {
+			fmt.Printf("[DRYRUN] Would write manifest → %s\n", a.zip+".manifest.json")
 		} else {
-			err = copyToWindowsShare(copyTo, filesToCopy, netUser, netPass, dryRun)
+			if err := writeManifest(a.zip, a.hash); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ Manifest error: %v\n", err)
+				exit(1)
+			}
+			fmt.Println("✅ Manifest created")
 		}
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "❌ Copy error: %v\n", err)
-			os.Exit(1)
+	}
+
+	// Chain step
+	if writeChain {
+		file := chainFile(a.zip)
+		if dryRun {
+			fmt.Printf("[DRYRUN] Would write verification chain → %s\n", file)
+			fmt.Printf("[DRYRUN] Would sign %s with %s → %s\n", file, signerName, chainSignatureFile(file))
+		} else {
+			if err := writeChainFile(a, targets); err != nil {
+				fail(stageErr(ErrSign, file, err))
+			}
+			fmt.Println("✅ Verification chain created")
 		}
-		fmt.Println("✅ Copy completed")
 	}
 
-	// Verify step
-	if verifyOnTarget && writeHash {
+	// Report step
+	if reportFormat != "" {
 		if dryRun {
-			fmt.Printf("[DRYRUN] Would verify SHA256 on %s\n", copyTo)
+			fmt.Printf("[DRYRUN] Would write release report → %s\n", reportFile(a.zip))
 		} else {
-			err := verifyHashOnTarget(copyTo, targetZip)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "❌ Hash verification failed: %v\n", err)
-				os.Exit(1)
+			if err := writeReport(a.zip, a.hash, targets); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ Report error: %v\n", err)
+				exit(1)
 			}
-			fmt.Println("✅ Remote file hash verified successfully")
+			fmt.Println("✅ Release report created")
+		}
+	}
+
+	// Files to copy
+	a.outputs = []string{a.zip}
+	if fileHashes {
+		a.outputs = append(a.outputs, a.zip+".files.sha256")
+	}
+	if recordXattrs {
+		a.outputs = append(a.outputs, a.zip+".xattrs.json")
+	}
+	if writeHash {
+		a.outputs = append(a.outputs, a.zip+".sha256")
+	}
+	if gpgSign && writeHash {
+		a.outputs = append(a.outputs, signatureFile(a.zip))
+	}
+	if makeTorrent {
+		a.outputs = append(a.outputs, a.zip+".torrent")
+	}
+	if makeZsync {
+		a.outputs = append(a.outputs, a.zip+".zsync")
+	}
+	if writeManifestFile {
+		a.outputs = append(a.outputs, a.zip+".manifest.json")
+	}
+	if writeChain {
+		a.outputs = append(a.outputs, chainFile(a.zip), chainSignatureFile(chainFile(a.zip)))
+	}
+	if reportFormat != "" && reportUpload {
+		a.outputs = append(a.outputs, reportFile(a.zip))
+	}
+	a.manifest = artifactManifest
+}
+
+func writeStepOutputs(artifacts []artifact) {
+	var outputs [][2]string
+	if len(artifacts) == 1 {
+		a := artifacts[0]
+		outputs = append(outputs, [2]string{"artifact", a.zip}, [2]string{"size", fmt.Sprint(fileSize(a.zip))})
+		if a.hash != "" {
+			outputs = append(outputs, [2]string{"sha256", a.hash})
+		}
+	} else {
+		// Several artifacts are listed as JSON, for fromJSON() in a matrix.
+		type output struct {
+			Artifact string `json:"artifact"`
+			Size     int64  `json:"size"`
+			SHA256   string `json:"sha256,omitempty"`
+		}
+		list := []output{}
+		for _, a := range artifacts {
+			list = append(list, output{a.zip, fileSize(a.zip), a.hash})
+		}
+		data, _ := json.Marshal(list)
+		outputs = append(outputs, [2]string{"artifacts", string(data)})
+	}
+	for _, o := range outputs {
+		if err := ghaOutput(o[0], o[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Cannot write step output %s: %v\n", o[0], err)
 		}
 	}
 }
 
+type sourceFile struct {
+	path  string
+	name  string
+	size  int64
+	first int // firstRank, 0 for files not listed by -first
+}
+
 func zipFolder(src, out string) error {
-	outFile, err := os.Create(out)
+	files, err := collectSource(src)
+	if err != nil {
+		return err
+	}
+	return zipFiles(files, out)
+}
+
+// collectSource lists the files to archive under src, recording the walk and
+// filter timings and writing -list-excluded.
+func collectSource(src string) ([]sourceFile, error) {
+	start := time.Now()
+	files, err := collectFiles(src)
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	recordStage("walk", start, total, len(files))
+	recordStageDuration("filter", time.Duration(filterNanos.Load()), 0, int(filterExcluded.Load()))
+	if listExcluded != "" && !dryRun {
+		if err := writeExcludedList(listExcluded); err != nil {
+			return nil, fmt.Errorf("cannot write -list-excluded: %w", err)
+		}
+		fmt.Printf("✅ Excluded paths listed in %s (%d)\n", listExcluded, len(excludedPaths))
+	}
+	return files, nil
+}
+
+func zipFiles(files []sourceFile, out string) (err error) {
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	files = orderFirst(files)
+	artifactManifest.Files = len(files)
+	artifactManifest.SourceSize = total
+	prog := startProgress("zip", total)
+	defer prog.finish()
+
+	var outFile io.WriteCloser
+	if directIO {
+		outFile, err = createDirect(out)
+	} else {
+		outFile, err = os.Create(out)
+	}
 	if err != nil {
 		return err
 	}
 	defer outFile.Close()
+	defer func() {
+		// A partial zip is useless and would only keep the volume full.
+		if errors.Is(err, errLowDiskSpace) {
+			outFile.Close()
+			os.Remove(out)
+		}
+	}()
+	outFile = guardFreeSpace(outFile, out)
 
 	zipWriter := zip.NewWriter(outFile)
 	defer zipWriter.Close()
 
-	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
+	done := make(chan struct{})
+	defer close(done)
+
+	var sums strings.Builder
+	var hashes []string
+	for item := range readAhead(files, hashingFiles(), done) {
+		hash, err := addToZip(zipWriter, item, prog)
+		if err != nil {
+			ghaError(item.file.path, err)
+			return stageErr(ErrZip, item.file.path, err)
+		}
+		if fileHashes || writeChain {
+			fmt.Fprintf(&sums, "%s  %s\n", hash, filepath.ToSlash(item.file.name))
+		}
+		if dropCache {
+			dropPageCache(item.file.path)
+		}
+		if verifySource != "" {
+			hashes = append(hashes, hash)
+		}
+	}
+	if fileHashes || writeChain {
+		tree := sha256.Sum256([]byte(sums.String()))
+		artifactManifest.TreeSHA256 = hex.EncodeToString(tree[:])
+	}
+	if aclSidecar {
+		if err := addACLEntry(zipWriter, files); err != nil {
 			return err
 		}
-		relPath, _ := filepath.Rel(filepath.Dir(src), path)
-		fw, err := zipWriter.Create(relPath)
-		if err != nil {
+	}
+	prog.finish()
+	start := time.Now()
+	if err := zipWriter.Close(); err != nil {
+		return err
+	}
+	if err := outFile.Close(); err != nil {
+		return err
+	}
+	recordStage("flush", start, fileSize(out), 0)
+	if recordXattrs {
+		if err := writeXattrsFile(out+".xattrs.json", files); err != nil {
 			return err
 		}
-		fr, err := os.Open(path)
-		if err != nil {
+	}
+	if fileHashes {
+		if err := os.WriteFile(out+".files.sha256", []byte(sums.String()), 0644); err != nil {
 			return err
 		}
-		defer fr.Close()
-		_, err = io.Copy(fw, fr)
-		return err
-	})
+	}
+	if verifySource != "" {
+		return verifySourceFiles(files, hashes)
+	}
+	return nil
+}
+
+// addToZip writes one entry and returns the SHA256 of its content when
+// -file-hashes, -verify-source or -chain is set. Small files arrive already hashed and compressed.
+func addToZip(zw *zip.Writer, item zipItem, prog *stageProgress) (string, error) {
+	if item.err != nil {
+		return "", item.err
+	}
+	prog.setFile(item.file.name)
+	if item.file.first > 0 {
+		return addStored(zw, item, prog)
+	}
+	if item.deflated != nil {
+		fw, err := zw.CreateRaw(item.rawHeader())
+		if err == nil {
+			_, err = fw.Write(item.deflated.Bytes())
+		}
+		prog.add(item.size)
+		item.release()
+		return item.hash, err
+	}
+	fw, err := zw.Create(filepath.ToSlash(item.file.name))
+	if err != nil {
+		return "", err
+	}
+	fw = pace(fw)
+	w := io.MultiWriter(fw, prog)
+	if useMmap && strconv.IntSize == 64 && item.file.size >= mmapMinSize {
+		sum, err := writeMapped(w, item.file.path)
+		if err != errMmapUnavailable {
+			return sum, err
+		}
+	}
+
+	var fr io.ReadCloser
+	if directIO {
+		fr, err = openDirectSource(item.file.path)
+	} else {
+		fr, err = openWithRetry(item.file.path)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer fr.Close()
+	if !hashingFiles() {
+		_, err = io.Copy(w, fr)
+		return "", err
+	}
+	h := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(w, h), fr); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+var errMmapUnavailable = errors.New("mmap unavailable")
+
+// writeMapped writes a memory-mapped file to w. It returns errMmapUnavailable
+// when the file can't be mapped so the caller falls back to buffered reads.
+func writeMapped(w io.Writer, path string) (string, error) {
+	data, unmap, err := mmapFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  mmap %s failed, using buffered reads: %v\n", path, err)
+		return "", errMmapUnavailable
+	}
+	defer unmap()
+
+	var h hash.Hash
+	if hashingFiles() {
+		h = sha256.New()
+		w = io.MultiWriter(w, h)
+	}
+	for len(data) > 0 {
+		n := min(len(data), 4<<20)
+		if _, err := w.Write(data[:n]); err != nil {
+			return "", err
+		}
+		data = data[n:]
+	}
+	if h == nil {
+		return "", nil
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
-func writeHashFile(filePath string) error {
+func writeHashFile(filePath string) (string, error) {
+	prog := startProgress("hash", fileSize(filePath))
+	defer prog.finish()
+	prog.setFile(filepath.Base(filePath))
+	hash, err := fileSHA256(filePath, prog)
+	if err != nil {
+		return "", err
+	}
+	hashLine := fmt.Sprintf("%s  %s\n", hash, filepath.Base(filePath))
+	return hash, os.WriteFile(filePath+".sha256", []byte(hashLine), 0644)
+}
+
+func fileSHA256(filePath string, prog *stageProgress) (string, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer f.Close()
 
 	h := sha256.New()
-	_, err = io.Copy(h, f)
+	if _, err = io.Copy(pace(io.MultiWriter(h, prog)), f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
 	if err != nil {
-		return err
+		return 0
 	}
-	hash := hex.EncodeToString(h.Sum(nil))
-	hashLine := fmt.Sprintf("%s  %s\n", hash, filepath.Base(filePath))
-	return os.WriteFile(filePath+".sha256", []byte(hashLine), 0644)
+	return info.Size()
 }
 
 func signWithGpg(file string) error {
-	cmd := exec.Command("gpg", "--armor", "--pinentry-mode", "loopback", "--output", file+".asc", "--sign", file)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("gpg error: %s\n%s", err, output)
+	args := []string{"--pinentry-mode", "loopback"}
+	if signKey != "" {
+		args = append(args, "--local-user", signKey)
+	}
+	var stdin io.Reader
+	if signPassphrase != "" {
+		pass, err := resolveSecret(signPassphrase, "")
+		if err != nil {
+			return fmt.Errorf("sign passphrase: %w", err)
+		}
+		args = append(args, "--batch", "--yes", "--passphrase-fd", "0")
+		stdin = strings.NewReader(pass + "\n")
+	}
+	switch signFormat {
+	case "binary":
+		args = append(args, "--output", file+".sig", "--detach-sign", file)
+	case "clearsign":
+		args = append(args, "--output", file+".asc", "--clearsign", file)
+	default:
+		args = append(args, "--armor", "--output", file+".asc", "--sign", file)
+	}
+	if _, stderr, err := runCommand(stdin, "gpg", args...); err != nil {
+		return fmt.Errorf("gpg error: %s\n%s", err, stderr)
 	}
 	return nil
 }
 
 func copyToWindowsShare(uncPath string, files []string, user, pass string, dryRun bool) error {
 	if dryRun {
-		fmt.Println("[DRYRUN] Would connect to:", uncPath)
+		if isUNC(uncPath) {
+			dryRunConnect(uncPath, user)
+		}
 		for _, file := range files {
-			fmt.Printf("[DRYRUN] Would copy %s → %s\n", file, filepath.Join(uncPath, filepath.Base(file)))
+			dest := filepath.Join(uncPath, filepath.Base(file))
+			fmt.Printf("[DRYRUN] Would copy %s → %s\n", file, dest)
+			dryRunAttrs(dest)
+			dryRunACLs(dest)
+		}
+		if keepPrevious > 0 {
+			dryRunPrevious(uncPath, baseNames(files))
 		}
 		return nil
 	}
 
-	args := []string{"net", "use", uncPath}
-	if user != "" && pass != "" {
-		args = append(args, pass, "/user:"+user)
+	if isUNC(uncPath) {
+		if err := useShare(uncPath, user, pass); err != nil {
+			return err
+		}
+	}
+	if keepPrevious > 0 {
+		if err := movePrevious(uncPath, baseNames(files)); err != nil {
+			return err
+		}
 	}
-	args = append(args, "/persistent:no")
-	cmd := exec.Command("cmd", "/C", strings.Join(args, " "))
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("net use failed: %s\n%s", err, output)
+
+	var total int64
+	for _, file := range files {
+		total += fileSize(file)
 	}
+	prog := startProgress("copy", total)
+	defer prog.finish()
 
 	for _, file := range files {
 		dest := filepath.Join(uncPath, filepath.Base(file))
-		src, err := os.Open(file)
-		if err != nil {
-			return err
+		prog.setFile(filepath.Base(file))
+		done := prog.bytes()
+		err := withRetry("copy "+file, func() error {
+			prog.rewind(done)
+			prepareDest(dest)
+			return copyFile(file, dest, prog)
+		})
+		if err == nil {
+			err = finishDest(file, dest)
 		}
-		defer src.Close()
-
-		out, err := os.Create(dest)
-		if err != nil {
-			return err
+		if err == nil {
+			err = applyACLs(dest)
 		}
-		defer out.Close()
-
-		if _, err = io.Copy(out, src); err != nil {
+		if err != nil {
+			ghaError(file, err)
 			return err
 		}
 	}
-
-	_ = exec.Command("cmd", "/C", "net", "use", uncPath, "/delete", "/yes").Run()
 	return nil
 }
 
-func copyWithRobocopy(uncPath string, files []string, user, pass string, dryRun bool) error {
-	if dryRun {
-		fmt.Println("[DRYRUN] Would robocopy to:", uncPath)
-		for _, f := range files {
-			fmt.Printf("[DRYRUN] Would robocopy file: %s\n", f)
-		}
-		return nil
+func copyFile(src, dest string, prog *stageProgress) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
 	}
+	defer in.Close()
 
-	args := []string{"net", "use", uncPath}
-	if user != "" && pass != "" {
-		args = append(args, pass, "/user:"+user)
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
 	}
-	args = append(args, "/persistent:no")
-	cmd := exec.Command("cmd", "/C", strings.Join(args, " "))
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("net use failed: %s\n%s", err, output)
+	if _, err = io.Copy(io.MultiWriter(out, prog), in); err != nil {
+		out.Close()
+		return err
 	}
+	return out.Close()
+}
 
+func copyWithRobocopy(uncPath string, files []string, user, pass string, dryRun bool) error {
 	group := map[string][]string{}
 	for _, f := range files {
 		dir := filepath.Dir(f)
 		group[dir] = append(group[dir], filepath.Base(f))
 	}
-
-	for dir, names := range group {
-		cmdArgs := append([]string{dir, uncPath}, names...)
+	dirs := slices.Sorted(maps.Keys(group))
+	robocopyArgs := func(dir string) []string {
+		cmdArgs := append([]string{dir, uncPath}, group[dir]...)
 		cmdArgs = append(cmdArgs, "/Z", "/R:3", "/W:5", "/NFL", "/NDL")
-		roboCmd := exec.Command("robocopy", cmdArgs...)
-		if output, err := roboCmd.CombinedOutput(); err != nil {
-			if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() >= 8 {
-				return fmt.Errorf("robocopy failed: %s\n%s", err, output)
+		return append(cmdArgs, robocopyAttrs()...)
+	}
+
+	if dryRun {
+		dryRunConnect(uncPath, user)
+		for _, dir := range dirs {
+			fmt.Println("[DRYRUN] Would run: robocopy", joinWindowsArgs(robocopyArgs(dir)))
+			for _, name := range group[dir] {
+				dryRunACLs(filepath.Join(uncPath, name))
 			}
 		}
+		if keepPrevious > 0 {
+			dryRunPrevious(uncPath, baseNames(files))
+		}
+		return nil
+	}
+
+	if err := useShare(uncPath, user, pass); err != nil {
+		return err
+	}
+	if keepPrevious > 0 {
+		if err := movePrevious(uncPath, baseNames(files)); err != nil {
+			return err
+		}
 	}
 
-	_ = exec.Command("cmd", "/C", "net", "use", uncPath, "/delete", "/yes").Run()
+	prog := startProgress("copy", 0)
+	defer prog.finish()
+
+	for _, dir := range dirs {
+		names := group[dir]
+		prog.setFile(strings.Join(names, ","))
+		cmdArgs := robocopyArgs(dir)
+		// Robocopy exit codes below 8 mean success; it reports on stdout.
+		if stdout, stderr, err := runCommand(nil, "robocopy", cmdArgs...); err != nil {
+			if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() >= 8 {
+				return fmt.Errorf("robocopy failed: %s\n%s%s", err, consoleText(stdout), stderr)
+			}
+		}
+		for _, name := range names {
+			if err := applyACLs(filepath.Join(uncPath, name)); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
+func isUNC(p string) bool {
+	return strings.HasPrefix(p, `\\`) || strings.HasPrefix(p, "//")
+}
+
+// uncShareRoot returns the \\server\share part of a UNC path, which is what
+// net use connects to.
+func uncShareRoot(p string) string {
+	parts := strings.FieldsFunc(p, func(r rune) bool { return r == '\\' || r == '/' })
+	if len(parts) < 2 {
+		return p
+	}
+	return `\\` + parts[0] + `\` + parts[1]
+}
+
 func verifyHashOnTarget(uncPath, localZip string) error {
 	zipName := filepath.Base(localZip)
 	remoteZip := filepath.Join(uncPath, zipName)
@@ -275,20 +1205,31 @@ func verifyHashOnTarget(uncPath, localZip string) error {
 	}
 	expected := strings.ToUpper(strings.Fields(string(hashData))[0])
 
-	cmd := exec.Command("certutil", "-hashfile", remoteZip, "SHA256")
-	out, err := cmd.CombinedOutput()
+	actual, err := remoteSHA256(remoteZip)
 	if err != nil {
-		return fmt.Errorf("certutil failed: %s\n%s", err, out)
-	}
-
-	lines := strings.Split(string(out), "\n")
-	if len(lines) < 2 {
-		return fmt.Errorf("unexpected certutil output:\n%s", out)
+		return err
 	}
-
-	actual := strings.TrimSpace(lines[1])
 	if actual != expected {
 		return fmt.Errorf("hash mismatch:\nExpected: %s\nActual:   %s", expected, actual)
 	}
 	return nil
 }
+
+// remoteSHA256 hashes a file on a target with certutil on Windows, so the
+// server-side read path is the one exercised, and in-process elsewhere.
+func remoteSHA256(path string) (string, error) {
+	if runtime.GOOS != "windows" {
+		sum, err := fileSHA256(path, nil)
+		return strings.ToUpper(sum), err
+	}
+	out, stderr, err := runCommand(nil, "certutil", "-hashfile", path, "SHA256")
+	if err != nil {
+		return "", fmt.Errorf("certutil failed: %s\n%s%s", err, consoleText(out), stderr)
+	}
+
+	lines := strings.Split(string(out), "\n")
+	if len(lines) < 2 {
+		return "", fmt.Errorf("unexpected certutil output:\n%s", out)
+	}
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(lines[1]), " ", "")), nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// manifest describes the published artifact. It is written next to the zip
+// with -manifest and copied to every target.
+type manifest struct {
+	Artifact   string      `json:"artifact"`
+	Size       int64       `json:"size"`
+	SHA256     string      `json:"sha256,omitempty"`
+	Created    time.Time   `json:"created"`
+	Files      int         `json:"files,omitempty"`
+	SourceSize int64       `json:"source_size,omitempty"`
+	TreeSHA256 string      `json:"tree_sha256,omitempty"`
+	Signatures []signature `json:"signatures,omitempty"`
+	InfoHash   string      `json:"torrent_info_hash,omitempty"`
+	IPFS       string      `json:"ipfs_cid,omitempty"`
+}
+
+var artifactManifest manifest
+
+// fillManifest sets the artifact fields of artifactManifest; the file counts
+// and signatures are added by the zip and sign steps.
+func fillManifest(zipPath, zipHash string) {
+	m := &artifactManifest
+	m.Artifact = filepath.Base(zipPath)
+	m.Size = fileSize(zipPath)
+	m.SHA256 = zipHash
+	if m.Created.IsZero() {
+		m.Created = time.Now().UTC().Truncate(time.Second)
+	}
+}
+
+func writeManifest(zipPath, zipHash string) error {
+	fillManifest(zipPath, zipHash)
+	data, err := json.MarshalIndent(&artifactManifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(zipPath+".manifest.json", append(data, '\n'), 0644)
+}
@@ -0,0 +1,9 @@
+//go:build !unix && !windows
+
+package main
+
+import "errors"
+
+func mmapFile(path string) ([]byte, func() error, error) {
+	return nil, nil, errors.New("memory-mapped reads are not supported on this platform")
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// net use sessions are shared by share: the first copy or source read that
+// needs \\server\share connects it, later ones (other targets on the share,
+// the verify step, parallel copies) reuse the connection, and every session
+// is disconnected when zipper exits. Disconnecting after each operation
+// would pull the share from under anything else still using it.
+//
+// Sessions aren't reference-counted: since teardown happens only at exit,
+// where every session goes regardless of holders, a count would decide
+// nothing. A count only matters for disconnecting a share early when its
+// last user lets go, which would reopen the race between a finished copy
+// and the next target on the same share.
+
+type netSession struct {
+	mu        sync.Mutex
+	share     string
+	user      string
+	connected bool
+}
+
+var (
+	netSessionsMu sync.Mutex
+	netSessions   = map[string]*netSession{}
+)
+
+// useShare connects to the share holding uncPath, unless it already is.
+func useShare(uncPath, user, pass string) error {
+	share := uncShareRoot(uncPath)
+	key := strings.ToLower(share)
+	netSessionsMu.Lock()
+	s := netSessions[key]
+	if s == nil {
+		s = &netSession{share: share}
+		netSessions[key] = s
+	}
+	netSessionsMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.connected {
+		if err := netUse(share, user, pass); err != nil {
+			return err
+		}
+		s.connected, s.user = true, user
+	} else if !strings.EqualFold(s.user, user) {
+		return fmt.Errorf("%s is already connected as %s; Windows allows one set of credentials per share", share, sessionUser(s.user))
+	}
+	return nil
+}
+
+func sessionUser(user string) string {
+	if user == "" {
+		return "the logon session"
+	}
+	return user
+}
+
+// closeShares disconnects every share useShare connected.
+func closeShares() {
+	netSessionsMu.Lock()
+	defer netSessionsMu.Unlock()
+	for key, s := range netSessions {
+		if s.connected {
+			netUseDelete(s.share)
+		}
+		delete(netSessions, key)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import "fmt"
+
+func netUse(uncPath, user, pass string) error {
+	return fmt.Errorf("cannot connect to %s: UNC sources need Windows; mount the share and use its path instead", uncPath)
+}
+
+func netUseDelete(share string) {}
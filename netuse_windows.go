@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modmpr                     = windows.NewLazySystemDLL("mpr.dll")
+	procWNetAddConnection2W    = modmpr.NewProc("WNetAddConnection2W")
+	procWNetCancelConnection2W = modmpr.NewProc("WNetCancelConnection2W")
+)
+
+const resourceTypeDisk = 1
+
+// netResource mirrors NETRESOURCEW from winnetwk.h.
+type netResource struct {
+	Scope       uint32
+	Type        uint32
+	DisplayType uint32
+	Usage       uint32
+	LocalName   *uint16
+	RemoteName  *uint16
+	Comment     *uint16
+	Provider    *uint16
+}
+
+// netUse connects to uncPath as "net use" would, without a drive letter and
+// not persisted. It calls WNetAddConnection2 rather than running net use so
+// the password never appears on a command line. Without credentials the
+// logon session is used, which is Kerberos in a domain.
+func netUse(uncPath, user, pass string) error {
+	remote, err := windows.UTF16PtrFromString(uncPath)
+	if err != nil {
+		return err
+	}
+	nr := netResource{Type: resourceTypeDisk, RemoteName: remote}
+	var u, p *uint16
+	if user != "" && pass != "" && authMode != "kerberos" {
+		if u, err = windows.UTF16PtrFromString(user); err != nil {
+			return err
+		}
+		if p, err = windows.UTF16PtrFromString(pass); err != nil {
+			return err
+		}
+	}
+	r, _, _ := procWNetAddConnection2W.Call(uintptr(unsafe.Pointer(&nr)), uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(u)), 0)
+	if r != 0 {
+		return fmt.Errorf("net use %s failed: %w", uncPath, syscall.Errno(r))
+	}
+	return nil
+}
+
+// netUseDelete disconnects share, even if files on it are still open.
+func netUseDelete(share string) {
+	name, err := windows.UTF16PtrFromString(share)
+	if err != nil {
+		return
+	}
+	procWNetCancelConnection2W.Call(uintptr(unsafe.Pointer(name)), 0, 1)
+}
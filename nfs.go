@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// NFS targets are either a mounted export, used like any directory, or an
+// nfs://server/export/path URL that is mounted for the duration of the copy
+// and verify steps (Linux only, needs permission to mount). -nfs-opts is
+// passed to mount -o, e.g. vers=4.1,sec=krb5.
+
+func isNFSURL(p string) bool {
+	return strings.HasPrefix(p, "nfs://")
+}
+
+func mountNFS(p string) (string, error) {
+	if runtime.GOOS != "linux" {
+		return "", fmt.Errorf("nfs:// targets need Linux; mount the export and use its path instead")
+	}
+	u, err := url.Parse(p)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid NFS URL %q (want nfs://server/export/path)", p)
+	}
+	dir, err := os.MkdirTemp("", "zipper-nfs-")
+	if err != nil {
+		return "", err
+	}
+	args := []string{"-t", "nfs"}
+	if nfsOpts != "" {
+		args = append(args, "-o", nfsOpts)
+	}
+	args = append(args, u.Host+":"+u.Path, dir)
+	if output, err := commandCombinedOutput(exec.Command("mount", args...)); err != nil {
+		os.Remove(dir)
+		return "", fmt.Errorf("mount failed: %s\n%s", err, output)
+	}
+	return dir, nil
+}
+
+// unmountDir unmounts a temporary mount point and removes it.
+func unmountDir(dir string) {
+	if output, err := commandCombinedOutput(exec.Command("umount", dir)); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  umount %s failed: %s\n%s", dir, err, output)
+		return
+	}
+	os.Remove(dir)
+}
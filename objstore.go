@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Cloud targets:
+//
+//	s3://bucket/prefix                                   (aws CLI credentials)
+//	gs://bucket/prefix                                   (Google token, see googleToken)
+//	https://account.blob.core.windows.net/container/prefix?<SAS>
+//	gdrive://folder-id                                   (Google token)
+//	dropbox://folder/path                                (Dropbox token)
+//	onedrive://drive-id/folder, sharepoint://host/sites/site/Library/folder
+//	                                                     (Microsoft Graph token)
+//
+// The target credential's password, if any, is the SAS token or access token.
+// Files are uploaded in -part-size chunks. The upload session is saved to
+// <file>.upload.json after every part so an interrupted run can continue with
+// -resume.
+
+func isCloudTarget(p string) bool {
+	return strings.HasPrefix(p, "s3://") || strings.HasPrefix(p, "gs://") || isAzureBlob(p) ||
+		strings.HasPrefix(p, "gdrive://") || isDropbox(p) || isGraph(p)
+}
+
+func isAzureBlob(p string) bool {
+	u, err := url.Parse(p)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") &&
+		strings.HasSuffix(u.Hostname(), ".blob.core.windows.net")
+}
+
+// splitBucket splits s3://bucket/prefix into the bucket and the object key
+// prefix.
+func splitBucket(p string) (string, string) {
+	_, rest, _ := strings.Cut(p, "://")
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	return bucket, strings.Trim(prefix, "/")
+}
+
+func objectKey(prefix, file string) string {
+	return path.Join(prefix, filepath.Base(file))
+}
+
+func uploadToCloud(dest string, files []string, secret string, dryRun bool) error {
+	if dryRun {
+		for _, file := range files {
+			fmt.Printf("[DRYRUN] Would upload %s → %s\n", file, strings.TrimRight(redactURL(dest), "/")+"/"+filepath.Base(file))
+		}
+		return nil
+	}
+
+	var total int64
+	for _, file := range files {
+		total += fileSize(file)
+	}
+	prog := startProgress("upload", total)
+	defer prog.finish()
+
+	for _, file := range files {
+		prog.setFile(filepath.Base(file))
+		var err error
+		switch {
+		case strings.HasPrefix(dest, "s3://"):
+			err = uploadS3(dest, file, prog)
+		case strings.HasPrefix(dest, "gs://"):
+			err = uploadGCS(dest, file, secret, prog)
+		case strings.HasPrefix(dest, "gdrive://"):
+			err = uploadDrive(dest, file, secret, prog)
+		case isDropbox(dest):
+			err = uploadDropbox(dest, file, secret, prog)
+		case isGraph(dest):
+			err = uploadGraph(dest, file, secret, prog)
+		default:
+			err = uploadAzureBlob(dest, file, secret, prog)
+		}
+		if err != nil {
+			ghaError(file, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// redactURL drops the query string, which holds the SAS token for Azure.
+func redactURL(p string) string {
+	if i := strings.IndexByte(p, '?'); i >= 0 {
+		return p[:i]
+	}
+	return p
+}
+
+// uploadState is the resumable session of one file upload.
+type uploadState struct {
+	Dest     string         `json:"dest"`
+	Size     int64          `json:"size"`
+	SHA256   string         `json:"sha256"`
+	PartSize int64          `json:"part_size"`
+	Session  string         `json:"session,omitempty"` // S3 upload ID, Google/Graph session URI, Dropbox session ID
+	Offset   int64          `json:"offset,omitempty"`  // bytes committed to a Dropbox session
+	Parts    map[int]string `json:"parts,omitempty"`   // part number → ETag or block ID
+
+	mu   sync.Mutex
+	path string
+}
+
+// loadUploadState returns the saved session for file → dest when -resume is
+// set and the file content is unchanged, or a fresh one. Content rather than
+// mtime is compared because a rerun rebuilds the (identical) zip. Without
+// -resume the file isn't hashed and the state isn't saved.
+func loadUploadState(file, dest string, partSize int64) (*uploadState, error) {
+	st := &uploadState{
+		Dest:     dest,
+		Size:     fileSize(file),
+		PartSize: partSize,
+		Parts:    map[int]string{},
+		path:     file + ".upload.json",
+	}
+	if !resumeUpload {
+		return st, nil
+	}
+	sum, err := fileSHA256(file, nil)
+	if err != nil {
+		return nil, err
+	}
+	st.SHA256 = sum
+	data, err := os.ReadFile(st.path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved uploadState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Ignoring unreadable upload state %s: %v\n", st.path, err)
+		return st, nil
+	}
+	if saved.Dest != dest || saved.Size != st.Size || saved.SHA256 != st.SHA256 || saved.PartSize != partSize {
+		fmt.Fprintf(os.Stderr, "⚠️  Upload state %s doesn't match %s, starting over\n", st.path, filepath.Base(file))
+		return st, nil
+	}
+	st.Session = saved.Session
+	st.Offset = saved.Offset
+	if saved.Parts != nil {
+		st.Parts = saved.Parts
+	}
+	fmt.Printf("Resuming upload of %s\n", filepath.Base(file))
+	return st, nil
+}
+
+func (st *uploadState) save() error {
+	if !resumeUpload {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := st.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.path)
+}
+
+func (st *uploadState) setPart(n int, id string) error {
+	st.mu.Lock()
+	st.Parts[n] = id
+	st.mu.Unlock()
+	return st.save()
+}
+
+func (st *uploadState) remove() {
+	os.Remove(st.path)
+}
+
+func (st *uploadState) partCount() int {
+	return int((st.Size + st.PartSize - 1) / st.PartSize)
+}
+
+// uploadParts uploads the parts missing from st on -upload-parallel
+// goroutines. Parts are numbered from 1. The first part that fails for good
+// (after its retries) stops the upload: no further parts are started.
+func uploadParts(st *uploadState, file string, prog *stageProgress, put func(n int, r io.ReadSeeker, size int64) (string, error)) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(runCtx)
+	defer cancel()
+	var (
+		progMu   sync.Mutex
+		failOnce sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		failOnce.Do(func() { firstErr = err })
+		cancel()
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < max(uploadParallel, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				off := int64(n-1) * st.PartSize
+				size := min(st.PartSize, st.Size-off)
+				var id string
+				err := withRetry(fmt.Sprintf("upload part %d of %s", n, filepath.Base(file)), func() error {
+					var err error
+					id, err = put(n, io.NewSectionReader(f, off, size), size)
+					return err
+				})
+				if err == nil {
+					err = st.setPart(n, id)
+				}
+				if err != nil {
+					fail(err)
+					continue
+				}
+				progMu.Lock()
+				prog.add(size)
+				progMu.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for n := 1; n <= st.partCount(); n++ {
+		st.mu.Lock()
+		_, done := st.Parts[n]
+		st.mu.Unlock()
+		if done {
+			progMu.Lock()
+			prog.add(min(st.PartSize, st.Size-int64(n-1)*st.PartSize))
+			progMu.Unlock()
+			continue
+		}
+		select {
+		case jobs <- n:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr == nil && runCtx.Err() != nil {
+		return fmt.Errorf("upload of %s cancelled", filepath.Base(file))
+	}
+	return firstErr
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUploadPartsStopsOnFailure(t *testing.T) {
+	defer func(r, p int) { retries, uploadParallel = r, p }(retries, uploadParallel)
+	retries, uploadParallel = 0, 2
+
+	file := filepath.Join(t.TempDir(), "app.zip")
+	if err := os.WriteFile(file, make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	st := &uploadState{Size: 100, PartSize: 1, Parts: map[int]string{}, path: file + ".upload.json"}
+	broken := errors.New("403 Forbidden")
+	var calls atomic.Int32
+	err := uploadParts(st, file, nil, func(n int, r io.ReadSeeker, size int64) (string, error) {
+		calls.Add(1)
+		if n == 3 {
+			return "", broken
+		}
+		time.Sleep(time.Millisecond)
+		return "etag", nil
+	})
+	if err != broken {
+		t.Fatalf("got %v, want %v", err, broken)
+	}
+	// Part 3 fails while the other worker has at most one more part going.
+	if n := calls.Load(); n > 5 {
+		t.Errorf("%d parts tried after part 3 failed for good, want the upload to stop", n)
+	}
+}
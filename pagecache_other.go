@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+
+package main
+
+// macOS and the BSDs have no way to evict a file's cached pages; they are
+// left to the OS.
+func dropPageCache(path string) error {
+	return nil
+}
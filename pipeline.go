@@ -0,0 +1,202 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// Files up to this size are read (and hashed) ahead of the compressor;
+	// larger ones are streamed by the writer.
+	readAheadMaxSize = 1 << 20
+	// Maximum number of files read ahead of the writer.
+	readAheadDepth = 64
+	// Files from this size are memory-mapped with -mmap.
+	mmapMinSize = 64 << 20
+)
+
+var bufPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// flatePool holds compressors at the level archive/zip uses, so entries
+// deflated by the readers are identical to ones the writer would produce.
+var flatePool = sync.Pool{New: func() any {
+	w, _ := flate.NewWriter(nil, 5)
+	return w
+}}
+
+type zipItem struct {
+	file     sourceFile
+	deflated *bytes.Buffer // compressed content; nil when the writer has to stream the file itself
+	crc      uint32
+	size     int64
+	hash     string
+	err      error
+}
+
+// release returns the item's buffer to the pool once it has been written.
+func (it *zipItem) release() {
+	putBuf(it.deflated)
+	it.deflated = nil
+}
+
+func putBuf(b *bytes.Buffer) {
+	if b != nil && b.Cap() <= 2*readAheadMaxSize {
+		b.Reset()
+		bufPool.Put(b)
+	}
+}
+
+// rawHeader describes an entry deflated ahead of time the way
+// zip.Writer.Create would have.
+func (it *zipItem) rawHeader() *zip.FileHeader {
+	return it.header(zip.Deflate, uint64(it.deflated.Len()))
+}
+
+// header describes the item's entry, written with method and compressed to
+// size bytes.
+func (it *zipItem) header(method uint16, size uint64) *zip.FileHeader {
+	fh := &zip.FileHeader{
+		Name:               filepath.ToSlash(it.file.name), // the zip spec wants forward slashes
+		Method:             method,
+		CreatorVersion:     20,
+		ReaderVersion:      20,
+		CRC32:              it.crc,
+		CompressedSize64:   size,
+		UncompressedSize64: uint64(it.size),
+	}
+	// archive/zip only sets the UTF-8 flag for names that aren't CP-437 safe.
+	for _, r := range fh.Name {
+		if r < 0x20 || r > 0x7d || r == 0x5c {
+			if utf8.ValidString(fh.Name) {
+				fh.Flags |= 0x800
+			}
+			break
+		}
+	}
+	return fh
+}
+
+type prefetchJob struct {
+	file sourceFile
+	res  chan zipItem
+}
+
+// readAhead opens, reads, hashes and compresses upcoming small files on
+// -prefetch goroutines while the writer handles the current one, so disk and
+// network latency, checksums and compression don't serialize behind a single
+// compressor. Workers finish in any order, but pending keeps a slot per file
+// in the order of files and the writer drains it in that order, so the
+// archive layout doesn't depend on scheduling.
+func readAhead(files []sourceFile, hash bool, done <-chan struct{}) <-chan zipItem {
+	workers := max(prefetchWorkers, 1)
+	jobs := make(chan prefetchJob)
+	pending := make(chan chan zipItem, readAheadDepth)
+
+	go func() {
+		defer close(jobs)
+		defer close(pending)
+		for _, f := range files {
+			res := make(chan zipItem, 1)
+			select {
+			case pending <- res:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- prefetchJob{file: f, res: res}:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			var busy time.Duration
+			for j := range jobs {
+				item := zipItem{file: j.file}
+				// -first files are stored by the writer, not deflated.
+				if j.file.size <= readAheadMaxSize && j.file.first == 0 {
+					var buf *bytes.Buffer
+					buf, item.hash, item.err = readAndHash(j.file, hash)
+					if buf != nil {
+						item.size = int64(buf.Len())
+						start := time.Now()
+						item.deflated, item.crc, item.err = deflate(buf.Bytes())
+						paceBusy(&busy, time.Since(start))
+						putBuf(buf)
+					}
+				}
+				j.res <- item
+			}
+		}()
+	}
+
+	out := make(chan zipItem)
+	go func() {
+		defer close(out)
+		for res := range pending {
+			var item zipItem
+			select {
+			case item = <-res:
+			case <-done:
+				return
+			}
+			select {
+			case out <- item:
+			case <-done:
+				return
+			}
+			if item.err != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func readAndHash(f sourceFile, hash bool) (*bytes.Buffer, string, error) {
+	r, err := openWithRetry(f.path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer r.Close()
+
+	buf := bufPool.Get().(*bytes.Buffer)
+	buf.Grow(int(f.size))
+	if _, err := io.Copy(buf, r); err != nil {
+		putBuf(buf)
+		return nil, "", err
+	}
+	if !hash {
+		return buf, "", nil
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return buf, hex.EncodeToString(sum[:]), nil
+}
+
+// deflate compresses data into a pooled buffer and returns its CRC-32.
+func deflate(data []byte) (*bytes.Buffer, uint32, error) {
+	out := bufPool.Get().(*bytes.Buffer)
+	fw := flatePool.Get().(*flate.Writer)
+	defer flatePool.Put(fw)
+	fw.Reset(out)
+	if _, err := fw.Write(data); err != nil {
+		putBuf(out)
+		return nil, 0, err
+	}
+	if err := fw.Close(); err != nil {
+		putBuf(out)
+		return nil, 0, err
+	}
+	return out, crc32.ChecksumIEEE(data), nil
+}
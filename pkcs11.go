@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DER prefix of the PKCS#1 v1.5 DigestInfo for SHA-256.
+var sha256DigestInfo = []byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}
+
+func pkcs11SlotOr(def string) string {
+	if pkcs11Slot != "" {
+		return pkcs11Slot
+	}
+	return def
+}
+
+// signPKCS11 signs the artifact digest on a hardware token (YubiKey, HSM)
+// through OpenSC's pkcs11-tool. Only the 32 byte digest is sent to the token,
+// so the signature verifies against the zip like the KMS ones. -sign-key is
+// the key label, or "id:<hex>" for a key ID.
+func signPKCS11(digest []byte, alg string) ([]byte, error) {
+	var input []byte
+	args := []string{"--module", pkcs11Module, "--slot", pkcs11SlotOr("0"), "--sign"}
+	switch alg {
+	case "RSA_PKCS1_SHA256":
+		input = append(append(input, sha256DigestInfo...), digest...)
+		args = append(args, "--mechanism", "RSA-PKCS")
+	case "ECDSA_SHA256":
+		input = digest
+		args = append(args, "--mechanism", "ECDSA", "--signature-format", "openssl")
+	default:
+		return nil, fmt.Errorf("unsupported -sign-alg %q for pkcs11 (want RSA_PKCS1_SHA256 or ECDSA_SHA256)", alg)
+	}
+	if id, ok := strings.CutPrefix(signKey, "id:"); ok {
+		args = append(args, "--id", id)
+	} else {
+		args = append(args, "--label", signKey)
+	}
+
+	var env []string
+	if pkcs11Pin != "" {
+		pin, err := resolveSecret(pkcs11Pin, "")
+		if err != nil {
+			return nil, fmt.Errorf("pkcs11 pin: %w", err)
+		}
+		// Passed through the environment so it doesn't show up in the
+		// process list.
+		env = append(os.Environ(), "ZIPPER_PKCS11_PIN="+pin)
+		args = append(args, "--login", "--pin", "env:ZIPPER_PKCS11_PIN")
+	}
+
+	dir, err := os.MkdirTemp("", "zipper-pkcs11-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "digest"), filepath.Join(dir, "sig")
+	if err := os.WriteFile(in, input, 0600); err != nil {
+		return nil, err
+	}
+	args = append(args, "--input-file", in, "--output-file", out)
+
+	cmd := exec.Command("pkcs11-tool", args...)
+	cmd.Env = env
+	if output, err := commandCombinedOutput(cmd); err != nil {
+		return nil, fmt.Errorf("pkcs11-tool failed: %s\n%s", err, output)
+	}
+	return os.ReadFile(out)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// -keep-previous moves the artifacts a copy to a file or UNC target would
+// overwrite into _previous/<UTC time of the run>/ on the target, so a bad
+// release can be rolled back by copying them back. Only the newest
+// -keep-previous of those folders are kept.
+
+const previousDir = "_previous"
+
+// previousStamp names this run's folder under _previous.
+var previousStamp = time.Now().UTC().Format("20060102T150405Z")
+
+func isPreviousStamp(name string) bool {
+	_, err := time.Parse("20060102T150405Z", name)
+	return err == nil
+}
+
+// movePrevious moves the existing copies of names in dir aside and prunes
+// the older folders.
+func movePrevious(dir string, names []string) error {
+	dest := filepath.Join(dir, previousDir, previousStamp)
+	moved := 0
+	for _, name := range names {
+		old := filepath.Join(dir, name)
+		if _, err := os.Stat(old); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(old, filepath.Join(dest, name)); err != nil {
+			return fmt.Errorf("cannot move the previous %s aside: %w", name, err)
+		}
+		moved++
+	}
+	if moved > 0 {
+		fmt.Printf("✅ Moved %d previous file(s) to %s\n", moved, dest)
+	}
+	return prunePrevious(filepath.Join(dir, previousDir))
+}
+
+// prunePrevious removes all but the newest -keep-previous folders in dir.
+func prunePrevious(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var stamps []string
+	for _, e := range entries {
+		if e.IsDir() && isPreviousStamp(e.Name()) {
+			stamps = append(stamps, e.Name())
+		}
+	}
+	slices.Sort(stamps)
+	for _, s := range stamps[:max(0, len(stamps)-keepPrevious)] {
+		old := filepath.Join(dir, s)
+		// -remote-attrs readonly copies must be made writable to be removed.
+		filepath.WalkDir(old, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				prepareDest(p)
+			}
+			return nil
+		})
+		if err := os.RemoveAll(old); err != nil {
+			return fmt.Errorf("cannot remove old release %s: %w", old, err)
+		}
+		fmt.Printf("Removed old release %s\n", old)
+	}
+	return nil
+}
+
+func baseNames(files []string) []string {
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = filepath.Base(f)
+	}
+	return names
+}
+
+// dryRunPrevious describes what movePrevious would do in dir.
+func dryRunPrevious(dir string, names []string) {
+	dest := filepath.Join(dir, previousDir, previousStamp)
+	fmt.Printf("[DRYRUN] Would move existing %s → %s\n", strings.Join(names, ", "), dest)
+	fmt.Printf("[DRYRUN] Would keep the newest %d release(s) in %s\n", keepPrevious, filepath.Join(dir, previousDir))
+}
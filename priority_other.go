@@ -0,0 +1,9 @@
+//go:build !unix && !windows
+
+package main
+
+import "errors"
+
+func setLowPriority() error {
+	return errors.New("low priority mode is not supported on this platform")
+}
@@ -0,0 +1,9 @@
+//go:build unix && !linux
+
+package main
+
+import "golang.org/x/sys/unix"
+
+func setLowPriority() error {
+	return unix.Setpriority(unix.PRIO_PROCESS, 0, 19)
+}
@@ -0,0 +1,14 @@
+package main
+
+import "golang.org/x/sys/windows"
+
+// setLowPriority lowers the priority class, which child processes such as gpg
+// and robocopy inherit, and enters background processing mode, which also
+// lowers I/O and memory priority of this process.
+func setLowPriority() error {
+	p := windows.CurrentProcess()
+	if err := windows.SetPriorityClass(p, windows.BELOW_NORMAL_PRIORITY_CLASS); err != nil {
+		return err
+	}
+	return windows.SetPriorityClass(p, windows.PROCESS_MODE_BACKGROUND_BEGIN)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+	"golang.org/x/term"
+)
+
+var (
+	progressMu sync.Mutex
+	progressW  io.Writer
+)
+
+// consoleVT is whether the terminal on stderr understands ANSI escape
+// sequences, see setupConsole. Without them the bar is drawn in ASCII and
+// redrawn with carriage returns only, which legacy consoles show correctly.
+var consoleVT = true
+
+type progressEvent struct {
+	Time       time.Time `json:"time"`
+	Event      string    `json:"event"`
+	Stage      string    `json:"stage"`
+	File       string    `json:"file,omitempty"`
+	BytesDone  int64     `json:"bytes_done"`
+	BytesTotal int64     `json:"bytes_total"`
+	Percent    float64   `json:"percent"`
+}
+
+// initProgress validates -progress-format and opens -progress-out, unless
+// this is a dry run. The output is opened without O_CREATE first so an
+// existing FIFO or Windows named pipe (\\.\pipe\name) is used as-is.
+func initProgress() error {
+	switch progressFormat {
+	case "bar", "none":
+		return nil
+	case "json":
+	default:
+		return fmt.Errorf("invalid -progress-format %q (want bar, json or none)", progressFormat)
+	}
+	// Events go to stderr by default so they don't mix with the result
+	// lines on stdout; "-" asks for stdout anyway.
+	switch progressOut {
+	case "":
+		progressW = os.Stderr
+		return nil
+	case "-":
+		progressW = os.Stdout
+		return nil
+	}
+	if dryRun {
+		fmt.Printf("[DRYRUN] Would write progress → %s\n", progressOut)
+		return nil
+	}
+	f, err := os.OpenFile(progressOut, os.O_WRONLY|os.O_APPEND, 0)
+	if os.IsNotExist(err) {
+		f, err = os.OpenFile(progressOut, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot open -progress-out: %w", err)
+	}
+	progressW = f
+	return nil
+}
+
+// stageProgress tracks the bytes processed by one stage. A nil
+// *stageProgress is valid and reports nothing.
+type stageProgress struct {
+	stage    string
+	total    int64
+	done     int64
+	file     string
+	start    time.Time
+	last     time.Time
+	finished bool
+	bar      *progressbar.ProgressBar
+}
+
+func startProgress(stage string, total int64) *stageProgress {
+	p := &stageProgress{stage: stage, total: total, start: time.Now()}
+	if p.reporting() {
+		p.emit("start")
+	}
+	if progressFormat == "bar" {
+		if total > 0 && term.IsTerminal(int(os.Stderr.Fd())) {
+			opts := []progressbar.Option{
+				progressbar.OptionSetWriter(os.Stderr),
+				progressbar.OptionSetDescription(stage),
+				progressbar.OptionShowBytes(true),
+				progressbar.OptionThrottle(100 * time.Millisecond),
+				progressbar.OptionClearOnFinish(),
+				progressbar.OptionUseANSICodes(consoleVT),
+			}
+			if !consoleVT {
+				opts = append(opts, progressbar.OptionSetTheme(progressbar.ThemeASCII))
+			}
+			p.bar = progressbar.NewOptions64(total, opts...)
+		}
+	}
+	return p
+}
+
+// reporting is whether progress events go anywhere: -progress-out or
+// -status-socket.
+func (p *stageProgress) reporting() bool {
+	return progressW != nil || statusOn
+}
+
+func (p *stageProgress) setFile(name string) {
+	if p == nil {
+		return
+	}
+	p.file = name
+	if p.reporting() {
+		p.emit("file")
+	}
+}
+
+// Write counts b. It fails once the run is interrupted, which stops the
+// copy it's part of.
+func (p *stageProgress) Write(b []byte) (int, error) {
+	if runCtx.Err() != nil {
+		return 0, errInterrupted
+	}
+	p.add(int64(len(b)))
+	return len(b), nil
+}
+
+func (p *stageProgress) add(n int64) {
+	if p == nil {
+		return
+	}
+	p.done += n
+	if p.bar != nil {
+		p.bar.Add64(n)
+	}
+	if p.reporting() && time.Since(p.last) >= 200*time.Millisecond {
+		p.emit("progress")
+	}
+}
+
+func (p *stageProgress) bytes() int64 {
+	if p == nil {
+		return 0
+	}
+	return p.done
+}
+
+// rewind resets the byte count, used when a retried step starts over.
+func (p *stageProgress) rewind(done int64) {
+	if p == nil || p.done == done {
+		return
+	}
+	p.done = done
+	if p.bar != nil {
+		p.bar.Set64(done)
+	}
+}
+
+// finish ends the stage and records its timing. Later calls do nothing.
+func (p *stageProgress) finish() {
+	if p == nil || p.finished {
+		return
+	}
+	p.finished = true
+	recordStage(p.stage, p.start, p.done, 0)
+	if p.bar != nil {
+		p.bar.Finish()
+	}
+	if p.reporting() {
+		p.emit("done")
+	}
+}
+
+func (p *stageProgress) emit(event string) {
+	ev := progressEvent{
+		Time:       time.Now().UTC(),
+		Event:      event,
+		Stage:      p.stage,
+		File:       p.file,
+		BytesDone:  p.done,
+		BytesTotal: p.total,
+	}
+	if p.total > 0 {
+		ev.Percent = math.Round(float64(p.done)*1000/float64(p.total)) / 10
+	} else if event == "done" {
+		ev.Percent = 100
+	}
+	p.last = time.Now()
+	publishStatus(ev)
+	if progressW == nil {
+		return
+	}
+
+	line, _ := json.Marshal(ev)
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progressW.Write(append(line, '\n'))
+}
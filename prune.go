@@ -0,0 +1,362 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// runPrune implements "zipper prune": it enforces retention on a target
+// outside of a packaging run, keeping the newest -keep artifacts matching
+// -pattern and deleting the rest along with their sidecars (files named after
+// the artifact plus an extension, like app-1.0.0.zip.sha256).
+func runPrune(args []string) int {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	dest := fs.String("target", "", "Target to prune: a local or UNC path, nfs://, s3://, gs:// or an Azure blob container URL")
+	pattern := fs.String("pattern", "", "Artifact file names to consider, e.g. 'app-*.zip'")
+	keep := fs.Int("keep", 0, "Number of newest artifacts to keep")
+	user := fs.String("user", "", "Username for a UNC target")
+	pass := fs.String("pass", "", "Password for -user, or the SAS or access token of a cloud target; may be a secret reference (env:, keyring:, dpapi:, vault:...)")
+	fs.BoolVar(&dryRun, "dryrun", false, "List what would be deleted without deleting it")
+	fs.StringVar(&proxyURL, "proxy", "", "HTTP(S) proxy (default from HTTPS_PROXY)")
+	fs.StringVar(&nfsOpts, "nfs-opts", "", "Mount options for nfs:// targets")
+	fs.Parse(args)
+	if *dest == "" || *pattern == "" || *keep < 1 || fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: zipper prune -target <dest> -pattern 'app-*.zip' -keep N [-user USER -pass PASS] [-dryrun]")
+		return 2
+	}
+	if _, err := path.Match(*pattern, ""); err != nil || strings.ContainsAny(*pattern, `/\`) {
+		fmt.Fprintf(os.Stderr, "❌ invalid -pattern %q (want a file name pattern)\n", *pattern)
+		return 2
+	}
+	if isSSH(*dest) || isIPFS(*dest) || (isCloudTarget(*dest) && !strings.HasPrefix(*dest, "s3://") &&
+		!strings.HasPrefix(*dest, "gs://") && !isAzureBlob(*dest)) {
+		fmt.Fprintf(os.Stderr, "❌ prune doesn't support %s (want a local or UNC path, nfs://, s3://, gs:// or an Azure blob container)\n", redactURL(*dest))
+		return 2
+	}
+	if err := setupProxy(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	secret, err := resolveSecret(*pass, *user)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ -pass: %v\n", err)
+		return 2
+	}
+	setupCancel()
+
+	target := *dest
+	f := &fetcher{}
+	defer f.close()
+	switch {
+	case isUNC(target):
+		if err := f.connect(target, *user, secret); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", redactSecrets(err.Error()))
+			return 1
+		}
+		target = f.local(target)
+	case isNFSURL(target):
+		dir, err := mountNFS(target)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		defer unmountDir(dir)
+		target = dir
+	}
+
+	files, err := listRemote(target, secret)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Cannot list %s: %v\n", redactURL(*dest), redactSecrets(err.Error()))
+		return 1
+	}
+	isArtifact := func(name string) bool {
+		ok, _ := path.Match(*pattern, name)
+		return ok && !isSidecar(name)
+	}
+	var artifacts []remoteFile
+	for _, rf := range files {
+		if isArtifact(rf.name) {
+			artifacts = append(artifacts, rf)
+		}
+	}
+	// Newest first; the name breaks ties so the result doesn't depend on
+	// listing order.
+	slices.SortFunc(artifacts, func(a, b remoteFile) int {
+		if c := b.modified.Compare(a.modified); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.name, a.name)
+	})
+	if len(artifacts) <= *keep {
+		fmt.Printf("✅ Nothing to prune: %d artifact(s) match %s, keeping %d\n", len(artifacts), *pattern, *keep)
+		return 0
+	}
+
+	deleted, failed := 0, 0
+	for _, a := range artifacts[*keep:] {
+		names := []string{a.name}
+		for _, rf := range files {
+			if !isArtifact(rf.name) && strings.HasPrefix(rf.name, a.name+".") {
+				names = append(names, rf.name)
+			}
+		}
+		for _, name := range names {
+			if dryRun {
+				fmt.Printf("[DRYRUN] Would delete %s\n", targetLocation(redactURL(*dest), name))
+				continue
+			}
+			if err := deleteRemote(target, name, secret); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ Cannot delete %s: %v\n", name, redactSecrets(err.Error()))
+				failed++
+				continue
+			}
+			deleted++
+		}
+	}
+	if dryRun {
+		return 0
+	}
+	if failed > 0 {
+		fmt.Printf("❌ Deleted %d file(s), %d failed\n", deleted, failed)
+		return 1
+	}
+	fmt.Printf("✅ Pruned %d artifact(s) (%d file(s)), kept the newest %d\n", len(artifacts)-*keep, deleted, *keep)
+	return 0
+}
+
+// sidecarSuffixes are the extensions of the files zipper writes next to an
+// artifact. A file ending in one is never counted as an artifact, however
+// broad -pattern is.
+var sidecarSuffixes = []string{".sha256", ".sig", ".asc", ".manifest.json", ".chain.json",
+	".xattrs.json", ".upload.json", ".torrent", ".zsync", ".report.md", ".report.html", ".report.json"}
+
+func isSidecar(name string) bool {
+	return slices.ContainsFunc(sidecarSuffixes, func(ext string) bool { return strings.HasSuffix(name, ext) })
+}
+
+type remoteFile struct {
+	name     string
+	modified time.Time
+}
+
+// listRemote lists the files directly in dest; subfolders, such as
+// _previous, are left out.
+func listRemote(dest, secret string) ([]remoteFile, error) {
+	var files []remoteFile
+	switch {
+	case strings.HasPrefix(dest, "s3://"):
+		bucket, prefix := splitBucket(dest)
+		args := []string{"s3api", "list-objects-v2", "--bucket", bucket, "--delimiter", "/"}
+		if prefix != "" {
+			args = append(args, "--prefix", prefix+"/")
+		}
+		out, err := runAWS(args...)
+		if err != nil {
+			return nil, err
+		}
+		var resp struct {
+			Contents []struct {
+				Key          string
+				LastModified string
+			}
+		}
+		if len(strings.TrimSpace(string(out))) > 0 {
+			if err := json.Unmarshal(out, &resp); err != nil {
+				return nil, fmt.Errorf("aws list-objects-v2: unexpected output:\n%s", out)
+			}
+		}
+		for _, o := range resp.Contents {
+			mtime, _ := time.Parse(time.RFC3339, o.LastModified)
+			files = append(files, remoteFile{name: path.Base(o.Key), modified: mtime})
+		}
+
+	case strings.HasPrefix(dest, "gs://"):
+		bucket, prefix := splitBucket(dest)
+		token, err := googleToken(secret, scopeStorage)
+		if err != nil {
+			return nil, err
+		}
+		q := url.Values{"delimiter": {"/"}}
+		if prefix != "" {
+			q.Set("prefix", prefix+"/")
+		}
+		for {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/storage/v1/b/%s/o?%s",
+				gcsEndpoint(), url.PathEscape(bucket), q.Encode()), nil)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			var page struct {
+				Items []struct {
+					Name    string    `json:"name"`
+					Updated time.Time `json:"updated"`
+				} `json:"items"`
+				NextPageToken string `json:"nextPageToken"`
+			}
+			if err := doJSON(req, &page); err != nil {
+				return nil, fmt.Errorf("gcs: %w", err)
+			}
+			for _, o := range page.Items {
+				files = append(files, remoteFile{name: path.Base(o.Name), modified: o.Updated})
+			}
+			if page.NextPageToken == "" {
+				break
+			}
+			q.Set("pageToken", page.NextPageToken)
+		}
+
+	case isAzureBlob(dest):
+		u, err := url.Parse(dest)
+		if err != nil {
+			return nil, err
+		}
+		if secret != "" {
+			u.RawQuery = strings.TrimPrefix(secret, "?")
+		}
+		container, prefix, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+		u.Path = "/" + container
+		for marker := ""; ; {
+			q := u.Query()
+			q.Set("restype", "container")
+			q.Set("comp", "list")
+			q.Set("delimiter", "/")
+			if prefix != "" {
+				q.Set("prefix", strings.Trim(prefix, "/")+"/")
+			}
+			if marker != "" {
+				q.Set("marker", marker)
+			}
+			var page struct {
+				Blobs []struct {
+					Name         string `xml:"Name"`
+					LastModified string `xml:"Properties>Last-Modified"`
+				} `xml:"Blobs>Blob"`
+				NextMarker string `xml:"NextMarker"`
+			}
+			if err := azureList(u, q, &page); err != nil {
+				return nil, err
+			}
+			for _, b := range page.Blobs {
+				mtime, _ := http.ParseTime(b.LastModified)
+				files = append(files, remoteFile{name: path.Base(b.Name), modified: mtime})
+			}
+			if marker = page.NextMarker; marker == "" {
+				break
+			}
+		}
+
+	default:
+		entries, err := os.ReadDir(dest)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, remoteFile{name: e.Name(), modified: info.ModTime()})
+		}
+	}
+	return files, nil
+}
+
+func azureList(u *url.URL, q url.Values, v any) error {
+	reqURL := *u
+	reqURL.RawQuery = q.Encode()
+	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-ms-version", azureVersion)
+	resp, err := httpClient.Do(req)
+	if ue, ok := err.(*url.Error); ok {
+		err = ue.Err
+	}
+	if err != nil {
+		return fmt.Errorf("azure list failed: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("azure list failed: %s\n%s", resp.Status, msg)
+	}
+	return xml.NewDecoder(resp.Body).Decode(v)
+}
+
+// deleteRemote deletes name from dest.
+func deleteRemote(dest, name, secret string) error {
+	switch {
+	case strings.HasPrefix(dest, "s3://"):
+		bucket, prefix := splitBucket(dest)
+		_, err := runAWS("s3api", "delete-object", "--bucket", bucket, "--key", path.Join(prefix, name))
+		return err
+
+	case strings.HasPrefix(dest, "gs://"):
+		bucket, prefix := splitBucket(dest)
+		token, err := googleToken(secret, scopeStorage)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/storage/v1/b/%s/o/%s",
+			gcsEndpoint(), url.PathEscape(bucket), url.PathEscape(path.Join(prefix, name))), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return deleteRequest("gcs", req, http.StatusNoContent)
+
+	case isAzureBlob(dest):
+		u, err := url.Parse(dest)
+		if err != nil {
+			return err
+		}
+		if secret != "" {
+			u.RawQuery = strings.TrimPrefix(secret, "?")
+		}
+		u.Path = path.Join("/", u.Path, name)
+		req, err := http.NewRequest(http.MethodDelete, u.String(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("x-ms-version", azureVersion)
+		return deleteRequest("azure", req, http.StatusAccepted)
+	}
+
+	file := filepath.Join(dest, name)
+	prepareDest(file)
+	return os.Remove(file)
+}
+
+func deleteRequest(service string, req *http.Request, want int) error {
+	resp, err := httpClient.Do(req)
+	if ue, ok := err.(*url.Error); ok {
+		// Don't leak a SAS signature in the request URL.
+		err = ue.Err
+	}
+	if err != nil {
+		return fmt.Errorf("%s delete failed: %s", service, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != want {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s delete failed: %s\n%s", service, resp.Status, msg)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const ageArmorHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+
+// runReencrypt implements "zipper reencrypt", which re-encrypts an artifact
+// for new keys without rebuilding it from source: an age file (.age) for new
+// recipients, or a zip with WinZip AES entries for a new password. The
+// artifact is replaced unless -out is given. A .sha256 sidecar next to it is
+// rewritten; signatures are left stale, with a warning.
+func runReencrypt(args []string) int {
+	fs := flag.NewFlagSet("reencrypt", flag.ExitOnError)
+	var identities, recipients, recipientFiles stringList
+	fs.Var(&identities, "identity", "age identity file that decrypts the artifact (repeatable)")
+	fs.Var(&recipients, "new-recipient", "age recipient to encrypt for: age1..., ssh-ed25519 ... (repeatable)")
+	fs.Var(&recipientFiles, "new-recipients-file", "File of age recipients to encrypt for, one per line (repeatable)")
+	pass := fs.String("pass", "", "Current password of an AES zip, or a secret reference (env:, keyring:, dpapi:, vault:...)")
+	newPass := fs.String("new-pass", "", "New password for an AES zip, or a secret reference")
+	out := fs.String("out", "", "Write the re-encrypted artifact here instead of replacing the input")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: zipper reencrypt -identity KEY -new-recipient age1... [-out FILE] ARTIFACT.age\n"+
+			"       zipper reencrypt -pass OLD -new-pass NEW [-out FILE] ARTIFACT.zip")
+		return 2
+	}
+	in := fs.Arg(0)
+	dest := *out
+	if dest == "" {
+		dest = in
+	}
+	isAge := strings.HasSuffix(in, ".age")
+	if isAge && len(identities) == 0 {
+		fmt.Fprintln(os.Stderr, "❌ -identity is needed to decrypt an age file")
+		return 2
+	}
+	if isAge && len(recipients)+len(recipientFiles) == 0 {
+		fmt.Fprintln(os.Stderr, "❌ Please provide -new-recipient or -new-recipients-file")
+		return 2
+	}
+	if !isAge && (*pass == "" || *newPass == "") {
+		fmt.Fprintln(os.Stderr, "❌ -pass and -new-pass are needed for an AES zip")
+		return 2
+	}
+	setupCancel()
+
+	// Write next to dest and rename, so a failure leaves the artifact as it was.
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".reencrypt-*")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer os.Remove(tmp.Name())
+	prog := startProgress("reencrypt", fileSize(in))
+	if isAge {
+		err = reencryptAge(in, tmp, identities, recipients, recipientFiles, prog)
+	} else {
+		var oldPw, newPw string
+		if oldPw, err = resolveSecret(*pass, ""); err == nil {
+			newPw, err = resolveSecret(*newPass, "")
+		}
+		if err == nil {
+			err = reencryptZip(in, tmp, oldPw, newPw, prog)
+		}
+	}
+	prog.finish()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		// CreateTemp made it 0600; keep the artifact's mode.
+		var info os.FileInfo
+		if info, err = os.Stat(in); err == nil {
+			err = os.Chmod(tmp.Name(), info.Mode().Perm())
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dest)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Re-encryption failed: %v\n", err)
+		return 1
+	}
+
+	if _, err := os.Stat(in + ".sha256"); err == nil {
+		if _, err := writeHashFile(dest); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Hash error: %v\n", err)
+			return 1
+		}
+	}
+	for _, ext := range []string{".asc", ".sig"} {
+		if _, err := os.Stat(in + ext); err == nil {
+			fmt.Fprintf(os.Stderr, "⚠️  %s signs the old ciphertext; sign %s again\n", in+ext, dest)
+		}
+	}
+	fmt.Printf("✅ Re-encrypted %s\n", dest)
+	return 0
+}
+
+// reencryptAge pipes "age --decrypt" into "age" for the new recipients, so
+// the plaintext never touches the disk. ASCII armor is kept if the input has
+// it.
+func reencryptAge(in string, out io.Writer, identities, recipients, recipientFiles []string, prog *stageProgress) error {
+	decArgs := []string{"--decrypt"}
+	for _, id := range identities {
+		decArgs = append(decArgs, "-i", id)
+	}
+	decArgs = append(decArgs, in)
+	var encArgs []string
+	if head, err := readHead(in, len(ageArmorHeader)); err != nil {
+		return err
+	} else if string(head) == ageArmorHeader {
+		encArgs = append(encArgs, "--armor")
+	}
+	for _, r := range recipients {
+		encArgs = append(encArgs, "-r", r)
+	}
+	for _, f := range recipientFiles {
+		encArgs = append(encArgs, "-R", f)
+	}
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	var decErr, encErr bytes.Buffer
+	decrypt := exec.CommandContext(runCtx, "age", decArgs...)
+	decrypt.Stdout, decrypt.Stderr = pw, &decErr
+	encrypt := exec.CommandContext(runCtx, "age", encArgs...)
+	encrypt.Stdin, encrypt.Stdout, encrypt.Stderr = pr, io.MultiWriter(out, prog), &encErr
+	decrypt.WaitDelay, encrypt.WaitDelay = cmdWaitDelay, cmdWaitDelay
+
+	runningCmds.Add(2)
+	defer runningCmds.Add(-2)
+	err = decrypt.Start()
+	if err == nil {
+		if err = encrypt.Start(); err != nil {
+			decrypt.Process.Kill()
+			decrypt.Wait()
+		}
+	}
+	pw.Close()
+	pr.Close()
+	if err != nil {
+		return fmt.Errorf("age failed: %s", err)
+	}
+	encWait := encrypt.Wait()
+	// A failed decryption ends the input early, which age would happily
+	// encrypt; its error comes first.
+	if err := decrypt.Wait(); err != nil {
+		return fmt.Errorf("age --decrypt failed: %s\n%s", err, decErr.Bytes())
+	}
+	if encWait != nil {
+		return fmt.Errorf("age failed: %s\n%s", encWait, encErr.Bytes())
+	}
+	return nil
+}
+
+// readHead returns up to n bytes from the start of file.
+func readHead(file string, n int) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b := make([]byte, n)
+	n, err = io.ReadFull(f, b)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = nil
+	}
+	return b[:n], err
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+type rekorEntry struct {
+	URL            string `json:"url"`
+	UUID           string `json:"uuid"`
+	LogIndex       int64  `json:"log_index"`
+	IntegratedTime int64  `json:"integrated_time"`
+}
+
+func validateRekor() error {
+	if !rekorPublish {
+		return nil
+	}
+	if !gpgSign || !writeHash {
+		return fmt.Errorf("-rekor needs -sign and -hash")
+	}
+	if signerName == "gpg" && signFormat != "binary" {
+		return fmt.Errorf("-rekor with GPG needs -sign-format binary (a detached signature)")
+	}
+	if signerName != "gpg" && rekorPubKey == "" {
+		return fmt.Errorf("-rekor with -signer %s needs -rekor-pubkey", signerName)
+	}
+	return nil
+}
+
+// publishRekor uploads the signature to a Rekor transparency log. GPG
+// signatures of the .sha256 file are logged as "rekord" entries; KMS and
+// PKCS#11 signatures of the artifact digest as "hashedrekord" entries.
+func publishRekor(zipPath, zipHash string, sig signature) (*rekorEntry, error) {
+	sigBytes, err := os.ReadFile(signatureFile(zipPath))
+	if err != nil {
+		return nil, err
+	}
+
+	var entry map[string]any
+	if signerName == "gpg" {
+		pub, err := gpgPublicKey()
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(zipPath + ".sha256")
+		if err != nil {
+			return nil, err
+		}
+		entry = map[string]any{
+			"apiVersion": "0.0.1",
+			"kind":       "rekord",
+			"spec": map[string]any{
+				"signature": map[string]any{
+					"format":    "pgp",
+					"content":   base64.StdEncoding.EncodeToString(sigBytes),
+					"publicKey": map[string]any{"content": base64.StdEncoding.EncodeToString(pub)},
+				},
+				"data": map[string]any{"content": base64.StdEncoding.EncodeToString(data)},
+			},
+		}
+	} else {
+		pub, err := os.ReadFile(rekorPubKey)
+		if err != nil {
+			return nil, err
+		}
+		entry = map[string]any{
+			"apiVersion": "0.0.1",
+			"kind":       "hashedrekord",
+			"spec": map[string]any{
+				"signature": map[string]any{
+					"content":   base64.StdEncoding.EncodeToString(sigBytes),
+					"publicKey": map[string]any{"content": base64.StdEncoding.EncodeToString(pub)},
+				},
+				"data": map[string]any{"hash": map[string]any{"algorithm": "sha256", "value": zipHash}},
+			},
+		}
+	}
+
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimRight(rekorURL, "/")
+	resp, err := httpClient.Post(base+"/api/v1/log/entries", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("rekor: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// An identical entry already in the log is returned as 409 with its
+	// location; fetch it so reruns record the same index.
+	if resp.StatusCode == http.StatusConflict && resp.Header.Get("Location") != "" {
+		loc := resp.Header.Get("Location")
+		if !strings.HasPrefix(loc, "http") {
+			loc = base + loc
+		}
+		resp.Body.Close()
+		if resp, err = httpClient.Get(loc); err != nil {
+			return nil, fmt.Errorf("rekor: %w", err)
+		}
+		defer resp.Body.Close()
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("rekor: %s\n%s", resp.Status, msg)
+	}
+
+	var entries map[string]struct {
+		LogIndex       int64 `json:"logIndex"`
+		IntegratedTime int64 `json:"integratedTime"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("rekor: unexpected response: %w", err)
+	}
+	for uuid, e := range entries {
+		return &rekorEntry{URL: base, UUID: uuid, LogIndex: e.LogIndex, IntegratedTime: e.IntegratedTime}, nil
+	}
+	return nil, fmt.Errorf("rekor: empty response")
+}
+
+func gpgPublicKey() ([]byte, error) {
+	args := []string{"--armor", "--export"}
+	if signKey != "" {
+		args = append(args, signKey)
+	}
+	out, stderr, err := runCommand(nil, "gpg", args...)
+	if err != nil {
+		return nil, fmt.Errorf("gpg export failed: %s\n%s", err, stderr)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("gpg export returned no public key")
+	}
+	return out, nil
+}
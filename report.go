@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// releaseReport is the data behind -report.
+type releaseReport struct {
+	manifest
+	Targets   []string      `json:"targets,omitempty"`
+	Timings   []stageTiming `json:"timings,omitempty"`
+	Generated time.Time     `json:"generated"`
+	// JSON only: the external commands run, and why a failed run failed.
+	Commands []commandRecord `json:"commands,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+var reportFuncs = map[string]any{
+	"size": func(n int64) string { return fmt.Sprintf("%s (%d bytes)", formatSize(n), n) },
+	"time": func(t time.Time) string { return t.Format(time.RFC3339) },
+	"secs": func(s float64) string { return fmt.Sprintf("%.3fs", s) },
+	"bytes": func(n int64) string {
+		if n == 0 {
+			return "-"
+		}
+		return formatSize(n)
+	},
+	"or": func(s, def string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	},
+	// md escapes characters that would break a Markdown table cell.
+	"md": func(s string) string {
+		return strings.NewReplacer("|", `\|`, "\\", `\\`, "\n", " ").Replace(s)
+	},
+}
+
+const markdownReport = `# Release {{md .Artifact}}
+
+| | |
+|---|---|
+| Artifact | {{md .Artifact}} |
+| Size | {{size .Size}} |
+| SHA256 | {{or .SHA256 "-"}} |
+{{- if .Files}}
+| Files | {{.Files}}, {{size .SourceSize}} uncompressed |
+{{- end}}
+| Created | {{time .Created}} |
+{{- if .IPFS}}
+| IPFS CID | {{.IPFS}} |
+{{- end}}
+{{if .Signatures}}
+## Signatures
+
+| File | Signer | Key | Transparency log |
+|---|---|---|---|
+{{- range .Signatures}}
+| {{md .File}} | {{.Signer}} | {{md (or .KeyID "-")}} | {{if .Rekor}}{{.Rekor.URL}} #{{.Rekor.LogIndex}}{{else}}-{{end}} |
+{{- end}}
+{{end}}
+{{- if .Targets}}
+## Targets
+{{range .Targets}}
+- {{md .}}
+{{- end}}
+{{end}}
+{{- if .Timings}}
+## Timings
+
+| Stage | Target | Time | Bytes | Rate | Files |
+|---|---|---|---|---|---|
+{{- range .Timings}}
+| {{.Stage}} | {{md (or .Target "-")}} | {{secs .Seconds}} | {{bytes .Bytes}} | {{.Rate}} | {{if .Files}}{{.Files}}{{else}}-{{end}} |
+{{- end}}
+{{end}}
+_Generated by zipper at {{time .Generated}}_
+`
+
+const htmlReport = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Release {{.Artifact}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+code { font-size: 90%; }
+</style>
+</head>
+<body>
+<h1>Release {{.Artifact}}</h1>
+<table>
+<tr><th>Artifact</th><td>{{.Artifact}}</td></tr>
+<tr><th>Size</th><td>{{size .Size}}</td></tr>
+<tr><th>SHA256</th><td><code>{{or .SHA256 "-"}}</code></td></tr>
+{{- if .Files}}
+<tr><th>Files</th><td>{{.Files}}, {{size .SourceSize}} uncompressed</td></tr>
+{{- end}}
+<tr><th>Created</th><td>{{time .Created}}</td></tr>
+{{- if .IPFS}}
+<tr><th>IPFS CID</th><td><code>{{.IPFS}}</code></td></tr>
+{{- end}}
+</table>
+{{- if .Signatures}}
+<h2>Signatures</h2>
+<table>
+<tr><th>File</th><th>Signer</th><th>Key</th><th>Transparency log</th></tr>
+{{- range .Signatures}}
+<tr><td>{{.File}}</td><td>{{.Signer}}</td><td><code>{{or .KeyID "-"}}</code></td><td>{{if .Rekor}}{{.Rekor.URL}} #{{.Rekor.LogIndex}}{{else}}-{{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Targets}}
+<h2>Targets</h2>
+<ul>
+{{- range .Targets}}
+<li><code>{{.}}</code></li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .Timings}}
+<h2>Timings</h2>
+<table>
+<tr><th>Stage</th><th>Target</th><th>Time</th><th>Bytes</th><th>Rate</th><th>Files</th></tr>
+{{- range .Timings}}
+<tr><td>{{.Stage}}</td><td>{{or .Target "-"}}</td><td>{{secs .Seconds}}</td><td>{{bytes .Bytes}}</td><td>{{.Rate}}</td><td>{{if .Files}}{{.Files}}{{else}}-{{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+<p><em>Generated by zipper at {{time .Generated}}</em></p>
+</body>
+</html>
+`
+
+func validateReport() error {
+	switch reportFormat {
+	case "", "md", "html", "json":
+		return nil
+	}
+	return fmt.Errorf("invalid -report %q (want md, html or json)", reportFormat)
+}
+
+func reportFile(zipPath string) string {
+	return zipPath + ".report." + reportFormat
+}
+
+// targetLocation returns where name ends up on target path p.
+func targetLocation(p, name string) string {
+	sep := "/"
+	if isUNC(p) && strings.Contains(p, `\`) {
+		sep = `\`
+	}
+	return strings.TrimRight(redactURL(p), `\/`) + sep + name
+}
+
+// writeReport writes the release report sidecar for zipPath.
+func writeReport(zipPath, zipHash string, targets []target) error {
+	fillManifest(zipPath, zipHash)
+	r := releaseReport{
+		manifest:  artifactManifest,
+		Timings:   timings(),
+		Generated: time.Now().UTC().Truncate(time.Second),
+		Commands:  commands(),
+	}
+	if runError != nil {
+		r.Error = redactSecrets(runError.Error())
+	}
+	for _, t := range targets {
+		if isIPFS(t.Path) {
+			if r.IPFS != "" {
+				r.Targets = append(r.Targets, "ipfs://"+r.IPFS)
+			}
+			continue
+		}
+		r.Targets = append(r.Targets, targetLocation(t.Path, artifactManifest.Artifact))
+	}
+
+	f, err := os.Create(reportFile(zipPath))
+	if err != nil {
+		return err
+	}
+	var w io.Writer = f
+	switch reportFormat {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(r)
+	case "html":
+		err = htmltemplate.Must(htmltemplate.New("report").Funcs(reportFuncs).Parse(htmlReport)).Execute(w, r)
+	default:
+		err = template.Must(template.New("report").Funcs(reportFuncs).Parse(markdownReport)).Execute(w, r)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
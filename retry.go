@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// withRetry runs fn until it succeeds or -retries is exhausted, doubling the
+// wait between attempts. Missing files and denied access are returned at
+// once, as trying again won't change them, and so is anything after an
+// interrupt.
+func withRetry(what string, fn func() error) error {
+	wait := retryWait
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= retries || errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) || runCtx.Err() != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "⚠️  %s failed (attempt %d/%d): %s, retrying in %s\n", what, attempt+1, retries+1, redactSecrets(err.Error()), wait)
+		select {
+		case <-time.After(wait):
+		case <-runCtx.Done():
+		}
+		wait *= 2
+	}
+}
+
+// retryReader reads a file and, when a read fails, reopens it and resumes at
+// the same offset so a flaky network share doesn't abort the whole archive.
+type retryReader struct {
+	path string
+	open func(string) (*os.File, error)
+	f    *os.File
+	off  int64
+}
+
+func openWithRetry(path string) (*retryReader, error) {
+	return openRetryReader(path, os.Open)
+}
+
+func openRetryReader(path string, open func(string) (*os.File, error)) (*retryReader, error) {
+	r := &retryReader{path: path, open: open}
+	err := withRetry("open "+path, func() error {
+		f, err := open(path)
+		if err != nil {
+			return err
+		}
+		r.f = f
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *retryReader) Read(p []byte) (int, error) {
+	n, err := r.f.Read(p)
+	if err != nil && err != io.EOF && n == 0 {
+		eof := false
+		err = withRetry("read "+r.path, func() error {
+			r.f.Close()
+			f, err := r.open(r.path)
+			if err != nil {
+				return err
+			}
+			r.f = f
+			if _, err = f.Seek(r.off, io.SeekStart); err != nil {
+				return err
+			}
+			n, err = f.Read(p)
+			if err == io.EOF {
+				eof = true
+				return nil
+			}
+			return err
+		})
+		if err == nil && eof {
+			err = io.EOF
+		}
+	}
+	r.off += int64(n)
+	return n, err
+}
+
+func (r *retryReader) Close() error {
+	return r.f.Close()
+}
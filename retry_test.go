@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWithRetry(t *testing.T) {
+	defer func(r int, w time.Duration) { retries, retryWait = r, w }(retries, retryWait)
+	retries, retryWait = 3, time.Millisecond
+
+	for _, tt := range []struct {
+		err   error
+		calls int
+	}{
+		{errors.New("connection reset"), 4},
+		{fmt.Errorf("open x: %w", os.ErrNotExist), 1},
+		{fmt.Errorf("open x: %w", os.ErrPermission), 1},
+	} {
+		calls := 0
+		err := withRetry("test", func() error {
+			calls++
+			return tt.err
+		})
+		if err != tt.err || calls != tt.calls {
+			t.Errorf("%v: got %v after %d calls, want %d calls", tt.err, err, calls, tt.calls)
+		}
+	}
+}
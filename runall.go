@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// runAll implements "zipper run-all": it runs the jobs of the config file,
+// each a separate zipper process, -parallel at a time, and writes a combined
+// report. Output lines are prefixed with the job name. A job's targets are
+// passed to it in a temporary config with the credentials, so secrets never
+// appear on a command line.
+func runAll(args []string) int {
+	fs := flag.NewFlagSet("run-all", flag.ExitOnError)
+	configFile := fs.String("config", "", "Config file with the jobs")
+	parallel := fs.Int("parallel", 1, "Jobs to run at once")
+	only := fs.String("jobs", "", "Comma-separated names of the jobs to run (default: all)")
+	format := fs.String("report", "", "Write a combined report: md or json")
+	reportOut := fs.String("report-out", "", "Combined report file (default: run-all.report.<md|json>)")
+	fs.BoolVar(&dryRun, "dryrun", false, "Run every job with -dryrun")
+	fs.Parse(args)
+	if *configFile == "" || *parallel < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: zipper run-all -config zipper.yaml [-parallel N] [-jobs a,b] [-report md|json] [-dryrun] [-- <flags for every job>]")
+		return 2
+	}
+	if *format != "" && *format != "md" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "❌ invalid -report %q (want md or json)\n", *format)
+		return 2
+	}
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Config error: %v\n", err)
+		return 2
+	}
+	jobs := cfg.Jobs
+	if *only != "" {
+		jobs = nil
+		for _, name := range strings.Split(*only, ",") {
+			i := slices.IndexFunc(cfg.Jobs, func(j job) bool { return j.Name == strings.TrimSpace(name) })
+			if i < 0 {
+				fmt.Fprintf(os.Stderr, "❌ No job %q in %s\n", name, *configFile)
+				return 2
+			}
+			jobs = append(jobs, cfg.Jobs[i])
+		}
+	}
+	if len(jobs) == 0 {
+		fmt.Fprintf(os.Stderr, "❌ %s has no jobs\n", *configFile)
+		return 2
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Running %d job(s), %d at a time\n", len(jobs), min(*parallel, len(jobs)))
+	results := make([]jobResult, len(jobs))
+	var outMu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, *parallel)
+	for i, j := range jobs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = runJob(exe, cfg, j, fs.Args(), &outMu)
+		}()
+	}
+	wg.Wait()
+
+	code := 0
+	var failed []string
+	for _, r := range results {
+		if r.ExitCode != 0 {
+			failed = append(failed, r.Name)
+			if code == 0 {
+				code = r.ExitCode
+			}
+		}
+	}
+	if *format != "" {
+		file := *reportOut
+		if file == "" {
+			file = "run-all.report." + *format
+		}
+		if dryRun {
+			fmt.Printf("[DRYRUN] Would write combined report → %s\n", file)
+		} else if err := writeRunAllReport(file, *format, results); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Report error: %v\n", err)
+			code = max(code, 1)
+		} else {
+			fmt.Printf("✅ Combined report written to %s\n", file)
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Printf("❌ %d of %d job(s) failed: %s\n", len(failed), len(jobs), strings.Join(failed, ", "))
+		return code
+	}
+	fmt.Printf("✅ All %d job(s) succeeded\n", len(jobs))
+	return code
+}
+
+// jobResult is a job's line in the combined report.
+type jobResult struct {
+	Name     string    `json:"name"`
+	ExitCode int       `json:"exit_code"`
+	Started  time.Time `json:"started"`
+	Seconds  float64   `json:"seconds"`
+	Artifact string    `json:"artifact,omitempty"`
+	Size     int64     `json:"size,omitempty"`
+	SHA256   string    `json:"sha256,omitempty"`
+	Targets  []string  `json:"targets,omitempty"`
+	Error    string    `json:"error,omitempty"` // the job's last ❌ line
+}
+
+// runJob runs job j and waits for it.
+func runJob(exe string, cfg *config, j job, extra []string, outMu *sync.Mutex) (r jobResult) {
+	r = jobResult{Name: j.Name, Started: time.Now().UTC().Truncate(time.Second)}
+	start := time.Now()
+	defer func() { r.Seconds = time.Since(start).Seconds() }()
+
+	args := append(slices.Clone(j.Flags), extra...)
+	args = append(args, "-src", j.Src, "-out", j.Out)
+	if dryRun {
+		args = append(args, "-dryrun")
+	}
+	if len(j.Targets) > 0 {
+		file, err := writeJobConfig(cfg, j)
+		if err != nil {
+			r.ExitCode, r.Error = 1, err.Error()
+			return r
+		}
+		defer os.Remove(file)
+		args = append(args, "-config", file)
+	}
+
+	prefix := "[" + j.Name + "] "
+	stdout := &jobOutput{w: os.Stdout, mu: outMu, prefix: prefix, lastError: &r.Error}
+	stderr := &jobOutput{w: os.Stderr, mu: outMu, prefix: prefix, lastError: &r.Error}
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := cmd.Run()
+	stdout.flush()
+	stderr.flush()
+	if ee, ok := err.(*exec.ExitError); ok {
+		r.ExitCode = ee.ExitCode()
+	} else if err != nil {
+		r.ExitCode, r.Error = 1, err.Error()
+	}
+	if r.ExitCode != 0 || dryRun {
+		return r
+	}
+
+	r.Artifact = filepath.Base(j.Out)
+	r.Size = fileSize(j.Out)
+	if data, err := os.ReadFile(j.Out + ".sha256"); err == nil {
+		r.SHA256, _, _ = strings.Cut(strings.TrimSpace(string(data)), " ")
+	}
+	for _, t := range j.Targets {
+		r.Targets = append(r.Targets, targetLocation(t.Path, r.Artifact))
+	}
+	return r
+}
+
+// writeJobConfig writes a config with the credentials and j's targets, for
+// the job's -config.
+func writeJobConfig(cfg *config, j job) (string, error) {
+	data, err := yaml.Marshal(config{Credentials: cfg.Credentials, Targets: j.Targets})
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp("", "zipper-job-*.yaml")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// jobOutput copies a job's output to w a line at a time, prefixed with the
+// job name, so parallel jobs don't interleave within a line. The last ❌
+// line of the job's stdout and stderr goes to *lastError.
+type jobOutput struct {
+	w         io.Writer
+	mu        *sync.Mutex
+	prefix    string
+	buf       []byte
+	lastError *string
+}
+
+func (o *jobOutput) Write(p []byte) (int, error) {
+	o.buf = append(o.buf, p...)
+	for {
+		i := bytes.IndexByte(o.buf, '\n')
+		if i < 0 {
+			break
+		}
+		o.line(o.buf[:i])
+		o.buf = o.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (o *jobOutput) flush() {
+	if len(o.buf) > 0 {
+		o.line(o.buf)
+		o.buf = nil
+	}
+}
+
+func (o *jobOutput) line(b []byte) {
+	// Progress bars redraw with \r; only the final state is worth a line.
+	if i := bytes.LastIndexByte(b, '\r'); i >= 0 {
+		b = b[i+1:]
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if msg, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "❌"); ok {
+		*o.lastError = strings.TrimSpace(msg)
+	}
+	fmt.Fprintf(o.w, "%s%s\n", o.prefix, b)
+}
+
+const runAllMarkdown = `# zipper run-all
+
+| Job | Result | Time | Artifact | Size | SHA256 |
+|---|---|---|---|---|---|
+{{- range .Jobs}}
+| {{md .Name}} | {{if .ExitCode}}❌ exit {{.ExitCode}}{{else}}✅{{end}} | {{secs .Seconds}} | {{md (or .Artifact "-")}} | {{if .Size}}{{bytes .Size}}{{else}}-{{end}} | {{or .SHA256 "-"}} |
+{{- end}}
+{{range .Jobs}}{{if .Error}}
+**{{md .Name}}**: {{md .Error}}
+{{end}}{{end}}
+{{- range .Jobs}}{{if .Targets}}
+## {{md .Name}} targets
+{{range .Targets}}
+- {{md .}}
+{{- end}}
+{{end}}{{end}}
+_Generated by zipper at {{time .Generated}}_
+`
+
+func writeRunAllReport(file, format string, results []jobResult) error {
+	report := struct {
+		Jobs      []jobResult `json:"jobs"`
+		Generated time.Time   `json:"generated"`
+	}{results, time.Now().UTC().Truncate(time.Second)}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = template.Must(template.New("run-all").Funcs(reportFuncs).Parse(runAllMarkdown)).Execute(f, report)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// S3 allows at most 10000 parts of at least 5 MiB.
+const (
+	s3MaxParts    = 10000
+	s3MinPartSize = 5 << 20
+)
+
+// uploadS3 uploads file with an S3 multipart upload through the aws CLI, so
+// the usual AWS credential chain and profile settings apply.
+func uploadS3(dest, file string, prog *stageProgress) error {
+	bucket, prefix := splitBucket(dest)
+	key := objectKey(prefix, file)
+	size := fileSize(file)
+	if size <= int64(partSize) {
+		err := withRetry("upload "+file, func() error {
+			_, err := runAWS("s3api", "put-object", "--bucket", bucket, "--key", key, "--body", file)
+			return err
+		})
+		prog.add(size)
+		return err
+	}
+
+	ps := max(int64(partSize), s3MinPartSize, (size+s3MaxParts-1)/s3MaxParts)
+	st, err := loadUploadState(file, "s3://"+bucket+"/"+key, ps)
+	if err != nil {
+		return err
+	}
+	if st.Session == "" {
+		out, err := runAWS("s3api", "create-multipart-upload", "--bucket", bucket, "--key", key)
+		if err != nil {
+			return err
+		}
+		var resp struct{ UploadId string }
+		if err := json.Unmarshal(out, &resp); err != nil || resp.UploadId == "" {
+			return fmt.Errorf("aws create-multipart-upload: unexpected output:\n%s", out)
+		}
+		st.Session = resp.UploadId
+		if err := st.save(); err != nil {
+			return err
+		}
+	}
+
+	err = uploadParts(st, file, prog, func(n int, r io.ReadSeeker, size int64) (string, error) {
+		// The CLI only takes a part body from a file.
+		tmp, err := os.CreateTemp("", "zipper-part-*")
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(tmp.Name())
+		_, err = io.Copy(tmp, r)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return "", err
+		}
+		out, err := runAWS("s3api", "upload-part", "--bucket", bucket, "--key", key,
+			"--upload-id", st.Session, "--part-number", strconv.Itoa(n), "--body", tmp.Name())
+		if err != nil {
+			return "", err
+		}
+		var resp struct{ ETag string }
+		if err := json.Unmarshal(out, &resp); err != nil || resp.ETag == "" {
+			return "", fmt.Errorf("aws upload-part: unexpected output:\n%s", out)
+		}
+		return resp.ETag, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	type part struct {
+		ETag       string
+		PartNumber int
+	}
+	var parts struct{ Parts []part }
+	for n := 1; n <= st.partCount(); n++ {
+		parts.Parts = append(parts.Parts, part{ETag: st.Parts[n], PartNumber: n})
+	}
+	list, err := json.Marshal(parts)
+	if err != nil {
+		return err
+	}
+	// The part list can exceed the command line limit, so pass it as a file.
+	listFile := st.path + ".parts"
+	if err := os.WriteFile(listFile, list, 0600); err != nil {
+		return err
+	}
+	defer os.Remove(listFile)
+	if _, err := runAWS("s3api", "complete-multipart-upload", "--bucket", bucket, "--key", key,
+		"--upload-id", st.Session, "--multipart-upload", "file://"+listFile); err != nil {
+		return err
+	}
+	st.remove()
+	return nil
+}
+
+func runAWS(args ...string) ([]byte, error) {
+	cmd := cloudCommand("aws", append(args, "--output", "json")...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := commandOutput(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("aws %s failed: %s\n%s", args[1], err, stderr.String())
+	}
+	return out, nil
+}
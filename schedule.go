@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf16"
+)
+
+// runSchedule implements "zipper schedule install|remove", which registers
+// (or deletes) a Windows Scheduled Task running zipper with the arguments
+// after "--". The task is defined as Task Scheduler XML so it can carry a
+// working directory, which schtasks /TR can't.
+func runSchedule(args []string) int {
+	usage := "Usage: zipper schedule install -name NAME -at HH:MM [-days MON,FRI] [-run-as USER -run-pass PASS] [-workdir DIR] [-xml] -- <zipper flags>\n" +
+		"       zipper schedule remove -name NAME"
+	if len(args) == 0 || (args[0] != "install" && args[0] != "remove") {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	fs := flag.NewFlagSet("schedule "+args[0], flag.ExitOnError)
+	name := fs.String("name", "zipper", "Task name, may include a folder: \\Builds\\nightly")
+	at := fs.String("at", "02:00", "Start time, HH:MM local time")
+	days := fs.String("days", "", "Run weekly on these days (MON,TUE,...); default daily")
+	runAs := fs.String("run-as", "", "Account to run as: DOMAIN\\user, SYSTEM or \"NETWORK SERVICE\" (default: current user, when logged on)")
+	runPass := fs.String("run-pass", "", "Password for -run-as, or a secret reference (env:, keyring:, dpapi:, vault:...)")
+	workDir := fs.String("workdir", "", "Working directory (default: the current one)")
+	printXML := fs.Bool("xml", false, "Print the task XML instead of registering it")
+	fs.Parse(args[1:])
+
+	if args[0] == "remove" {
+		return runSchtasks("/Delete", "/TN", *name, "/F")
+	}
+
+	if len(fs.Args()) == 0 {
+		fmt.Fprintln(os.Stderr, "❌ No zipper flags after --; the task would do nothing")
+		return 2
+	}
+	var task scheduledTask
+	clock, err := time.Parse("15:04", *at)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ invalid -at %q (want HH:MM)\n", *at)
+		return 2
+	}
+	now := time.Now()
+	task.Start = time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local)
+	if task.Days, err = taskDays(*days); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	if task.Command, err = os.Executable(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	task.Arguments = joinWindowsArgs(fs.Args())
+	task.WorkDir = *workDir
+	if task.WorkDir == "" {
+		task.WorkDir, _ = os.Getwd()
+	}
+	task.WorkDir, _ = filepath.Abs(task.WorkDir)
+
+	doc, err := task.xml()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if *printXML {
+		fmt.Print(doc)
+		return 0
+	}
+	if runtime.GOOS != "windows" {
+		fmt.Fprintln(os.Stderr, "❌ Scheduled tasks need Windows; use -xml to see the definition")
+		return 1
+	}
+
+	f, err := os.CreateTemp("", "zipper-task-*.xml")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer os.Remove(f.Name())
+	// schtasks expects the XML as UTF-16 with a byte order mark.
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, 0xFE})
+	for _, u := range utf16.Encode([]rune(doc)) {
+		buf.Write([]byte{byte(u), byte(u >> 8)})
+	}
+	_, err = f.Write(buf.Bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+
+	schArgs := []string{"/Create", "/TN", *name, "/XML", f.Name(), "/F"}
+	var code int
+	switch strings.ToUpper(*runAs) {
+	case "":
+		code = runSchtasks(schArgs...)
+	case "SYSTEM", "NETWORK SERVICE", "LOCAL SERVICE":
+		code = runSchtasks(append(schArgs, "/RU", *runAs)...)
+	default:
+		pass, err := resolveSecret(*runPass, *runAs)
+		if err != nil || pass == "" {
+			fmt.Fprintf(os.Stderr, "❌ -run-as %s needs -run-pass so the task can run while logged off: %v\n", *runAs, err)
+			return 2
+		}
+		code = registerTaskAs(*name, f.Name(), *runAs, pass)
+	}
+	if code != 0 {
+		return code
+	}
+	fmt.Printf("✅ Scheduled task %s registered: %s\n", *name, task.describe())
+	return 0
+}
+
+func runSchtasks(args ...string) int {
+	output, err := exec.Command("schtasks", args...).CombinedOutput()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ schtasks failed: %s\n%s", err, consoleText(output))
+		return 1
+	}
+	return 0
+}
+
+// registerTaskAs registers the task XML in file to run as user, with
+// Register-ScheduledTask. schtasks only takes the password on its command
+// line, where other users can see it; PowerShell reads this script from
+// stdin.
+func registerTaskAs(name, file, user, pass string) int {
+	folder, leaf := `\`, name
+	if i := strings.LastIndex(name, `\`); i >= 0 {
+		folder, leaf = name[:i+1], name[i+1:]
+	}
+	if !strings.HasPrefix(folder, `\`) {
+		folder = `\` + folder
+	}
+	script := fmt.Sprintf("$ErrorActionPreference = 'Stop'\n"+
+		"Register-ScheduledTask -TaskName %s -TaskPath %s -Xml (Get-Content -Raw -LiteralPath %s) -User %s -Password %s -Force | Out-Null\n",
+		psQuote(leaf), psQuote(folder), psQuote(file), psQuote(user), psQuote(pass))
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", "-")
+	cmd.Stdin = strings.NewReader(script)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Register-ScheduledTask failed: %s\n%s", err, redactSecrets(string(consoleText(output))))
+		return 1
+	}
+	return 0
+}
+
+// psQuote quotes s as a PowerShell single-quoted string.
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+type scheduledTask struct {
+	Start     time.Time
+	Days      string // weekly days as Task Scheduler elements, empty for daily
+	Command   string
+	Arguments string
+	WorkDir   string
+}
+
+var taskDayNames = map[string]string{
+	"MON": "Monday", "TUE": "Tuesday", "WED": "Wednesday", "THU": "Thursday",
+	"FRI": "Friday", "SAT": "Saturday", "SUN": "Sunday",
+}
+
+// taskDays turns "MON,FRI" into the DaysOfWeek elements of a weekly trigger.
+func taskDays(spec string) (string, error) {
+	var out strings.Builder
+	for _, d := range strings.Split(spec, ",") {
+		d = strings.ToUpper(strings.TrimSpace(d))
+		if d == "" {
+			continue
+		}
+		full, ok := taskDayNames[d]
+		if !ok {
+			return "", fmt.Errorf("invalid day %q in -days (want MON,TUE,WED,THU,FRI,SAT,SUN)", d)
+		}
+		out.WriteString("<" + full + "/>")
+	}
+	return out.String(), nil
+}
+
+func (t scheduledTask) describe() string {
+	when := "daily"
+	if t.Days != "" {
+		when = "weekly"
+	}
+	return fmt.Sprintf("%s at %s in %s", when, t.Start.Format("15:04"), t.WorkDir)
+}
+
+var taskTemplate = template.Must(template.New("task").Funcs(template.FuncMap{"esc": xmlEscape}).Parse(
+	`<?xml version="1.0" encoding="UTF-16"?>
+<Task version="1.2" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">
+  <RegistrationInfo>
+    <Description>zipper {{esc .Arguments}}</Description>
+  </RegistrationInfo>
+  <Triggers>
+    <CalendarTrigger>
+      <StartBoundary>{{.Start.Format "2006-01-02T15:04:05"}}</StartBoundary>
+      <Enabled>true</Enabled>
+{{- if .Days}}
+      <ScheduleByWeek>
+        <DaysOfWeek>{{.Days}}</DaysOfWeek>
+        <WeeksInterval>1</WeeksInterval>
+      </ScheduleByWeek>
+{{- else}}
+      <ScheduleByDay>
+        <DaysInterval>1</DaysInterval>
+      </ScheduleByDay>
+{{- end}}
+    </CalendarTrigger>
+  </Triggers>
+  <Settings>
+    <MultipleInstancesPolicy>IgnoreNew</MultipleInstancesPolicy>
+    <StartWhenAvailable>true</StartWhenAvailable>
+    <DisallowStartIfOnBatteries>false</DisallowStartIfOnBatteries>
+    <StopIfGoingOnBatteries>false</StopIfGoingOnBatteries>
+    <ExecutionTimeLimit>PT12H</ExecutionTimeLimit>
+  </Settings>
+  <Actions>
+    <Exec>
+      <Command>{{esc .Command}}</Command>
+      <Arguments>{{esc .Arguments}}</Arguments>
+      <WorkingDirectory>{{esc .WorkDir}}</WorkingDirectory>
+    </Exec>
+  </Actions>
+</Task>
+`))
+
+func (t scheduledTask) xml() (string, error) {
+	var b strings.Builder
+	err := taskTemplate.Execute(&b, t)
+	return b.String(), err
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// joinWindowsArgs quotes arguments the way the Windows C runtime splits a
+// command line.
+func joinWindowsArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a != "" && !strings.ContainsAny(a, " \t\"") {
+			quoted[i] = a
+			continue
+		}
+		var b strings.Builder
+		b.WriteByte('"')
+		slashes := 0
+		for _, r := range a {
+			switch r {
+			case '\\':
+				slashes++
+			case '"':
+				// Backslashes before a quote are doubled, and the quote escaped.
+				b.WriteString(strings.Repeat(`\`, slashes+1))
+				slashes = 0
+			default:
+				slashes = 0
+			}
+			b.WriteRune(r)
+		}
+		// So are backslashes before the closing quote.
+		b.WriteString(strings.Repeat(`\`, slashes))
+		b.WriteByte('"')
+		quoted[i] = b.String()
+	}
+	return strings.Join(quoted, " ")
+}
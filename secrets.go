@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// resolveCredential resolves the password reference of c. A credman:
+// reference also supplies the user name when c has none.
+func resolveCredential(c credential) (string, string, error) {
+	if target, ok := strings.CutPrefix(c.Password, "credman:"); ok {
+		user, pass, err := credmanRead(target)
+		if err != nil {
+			return "", "", err
+		}
+		addSecret(pass)
+		if c.User != "" {
+			user = c.User
+		}
+		return user, pass, nil
+	}
+	pass, err := resolveSecret(c.Password, c.User)
+	return c.User, pass, err
+}
+
+// resolveSecret turns a secret reference into its value:
+//
+//	env:NAME           environment variable
+//	keyring:service    OS keyring entry for service (and account, if given)
+//	credman:target     Windows Credential Manager generic credential
+//	dpapi:base64       Windows DPAPI encrypted value, see "zipper dpapi protect"
+//	vault:path#field   HashiCorp Vault KV secret, see vaultRead
+//
+// Anything else is returned as a literal. The value is remembered so
+// redactSecrets can hide it.
+func resolveSecret(ref, account string) (v string, err error) {
+	defer func() { addSecret(v) }()
+	scheme, rest, ok := strings.Cut(ref, ":")
+	if !ok {
+		return ref, nil
+	}
+	switch scheme {
+	case "env":
+		v, ok := os.LookupEnv(rest)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", rest)
+		}
+		return v, nil
+	case "keyring":
+		return keyringLookup(rest, account)
+	case "credman":
+		_, pass, err := credmanRead(rest)
+		return pass, err
+	case "dpapi":
+		return dpapiUnprotect(rest)
+	case "vault":
+		return vaultRead(rest)
+	}
+	return ref, nil
+}
+
+var (
+	secretsMu    sync.Mutex
+	knownSecrets []string
+)
+
+// addSecret remembers a password or passphrase so redactSecrets hides it.
+// Values shorter than 3 characters would redact half of every message and
+// are ignored.
+func addSecret(s string) {
+	if len(s) < 3 {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	if !slices.Contains(knownSecrets, s) {
+		knownSecrets = append(knownSecrets, s)
+		// Longest first, so a secret containing another is hidden whole.
+		slices.SortFunc(knownSecrets, func(a, b string) int { return len(b) - len(a) })
+	}
+}
+
+// redactSecrets replaces every known secret in s with ***.
+func redactSecrets(s string) string {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, secret := range knownSecrets {
+		s = strings.ReplaceAll(s, secret, "***")
+	}
+	return s
+}
+
+func keyringLookup(service, account string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		_, pass, err := credmanRead(service)
+		return pass, err
+	case "darwin":
+		args := []string{"find-generic-password", "-s", service, "-w"}
+		if account != "" {
+			args = append(args, "-a", account)
+		}
+		cmd = exec.Command("security", args...)
+	default:
+		args := []string{"lookup", "service", service}
+		if account != "" {
+			args = append(args, "account", account)
+		}
+		cmd = exec.Command("secret-tool", args...)
+	}
+	out, err := commandOutput(cmd)
+	if err != nil {
+		return "", fmt.Errorf("keyring lookup of %s failed: %s", service, err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runServe implements "zipper serve", a read-only HTTP service that checks
+// artifacts for receivers without zipper installed:
+//
+//	POST /verify   multipart upload: archive, and optionally sha256, signature, manifest
+//	GET  /verify?path=\\server\share\app.zip   sidecars are found next to the file
+//
+// Both answer with the archive's SHA256 and whether its checksum sidecar,
+// signature and manifest match. With -tls-cert/-tls-key it serves HTTPS, and
+// with -client-ca it only accepts clients with a certificate from that CA.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8080", "Address to listen on")
+	fs.StringVar(&tlsCert, "tls-cert", "", "PEM server certificate")
+	fs.StringVar(&tlsKey, "tls-key", "", "PEM private key for -tls-cert")
+	clientCA := fs.String("client-ca", "", "Require client certificates issued by the CAs in this PEM bundle")
+	var allow stringList
+	fs.Var(&allow, "allow-path", "Directory GET /verify?path= may read from, including its subdirectories; a plain path, not a glob (repeatable; without -allow-path, GET /verify?path= is refused)")
+	maxUpload := byteSize(4 << 30)
+	fs.Var(&maxUpload, "max-upload", "Largest accepted upload")
+	pubKey := fs.String("pubkey", "", "PEM public key to check KMS/PKCS#11 .sig signatures with (GPG uses the keyring)")
+	fs.Parse(args)
+
+	cfg, err := tlsConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	if *clientCA != "" {
+		if tlsCert == "" {
+			fmt.Fprintln(os.Stderr, "❌ -client-ca needs -tls-cert and -tls-key")
+			return 2
+		}
+		// Only the given CAs: the system roots would admit any public certificate.
+		if cfg.ClientCAs, err = loadCAPool(*clientCA, false); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	var pub crypto.PublicKey
+	if *pubKey != "" {
+		if pub, err = loadPublicKey(*pubKey); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+	}
+
+	v := &verifier{allow: allow, maxUpload: int64(maxUpload), pub: pub}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /verify", v.verifyPath)
+	mux.HandleFunc("POST /verify", v.verifyUpload)
+	srv := &http.Server{Addr: *listen, Handler: mux, TLSConfig: cfg, ReadHeaderTimeout: 30 * time.Second}
+
+	if tlsCert == "" {
+		fmt.Fprintln(os.Stderr, "⚠️  Serving plain HTTP without authentication; use -tls-cert/-tls-key and -client-ca outside localhost")
+		fmt.Printf("✅ Listening on http://%s\n", *listen)
+		err = srv.ListenAndServe()
+	} else {
+		fmt.Printf("✅ Listening on https://%s\n", *listen)
+		err = srv.ListenAndServeTLS("", "")
+	}
+	fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+	return 1
+}
+
+type verifier struct {
+	allow     []string
+	maxUpload int64
+	pub       crypto.PublicKey
+}
+
+type checkResult struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"` // the problem, or the signing key
+}
+
+type verifyResult struct {
+	Artifact  string       `json:"artifact"`
+	Size      int64        `json:"size"`
+	SHA256    string       `json:"sha256"`
+	Checksum  *checkResult `json:"checksum,omitempty"`
+	Signature *checkResult `json:"signature,omitempty"`
+	Manifest  *checkResult `json:"manifest,omitempty"`
+	OK        bool         `json:"ok"`
+	Detail    string       `json:"detail,omitempty"`
+}
+
+func (v *verifier) verifyPath(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		http.Error(w, "missing path", http.StatusBadRequest)
+		return
+	}
+	if len(v.allow) == 0 {
+		http.Error(w, "GET /verify?path= is disabled: the service was started without -allow-path", http.StatusForbidden)
+		return
+	}
+	if !v.allowed(p) {
+		http.Error(w, "path is outside -allow-path", http.StatusForbidden)
+		return
+	}
+	if info, err := os.Stat(p); err == nil && info.IsDir() {
+		http.Error(w, p+" is a directory", http.StatusBadRequest)
+		return
+	}
+	sum, err := fileSHA256(p, nil)
+	if err != nil {
+		http.Error(w, err.Error(), fileErrorStatus(err))
+		return
+	}
+	writeVerifyResult(w, v.check(p, sum))
+}
+
+// fileErrorStatus is the HTTP status for an error reading a requested file.
+func fileErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, os.ErrPermission):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// allowed reports whether p is inside one of the -allow-path directories,
+// after resolving symlinks so a link can't lead outside. A missing file is
+// placed by its directory, so it gets a 404 rather than a 403.
+func (v *verifier) allowed(p string) bool {
+	real, err := filepath.EvalSymlinks(p)
+	if errors.Is(err, os.ErrNotExist) {
+		var dir string
+		if dir, err = filepath.EvalSymlinks(filepath.Dir(p)); err == nil {
+			real = filepath.Join(dir, filepath.Base(p))
+		}
+	}
+	if err != nil {
+		return false
+	}
+	for _, dir := range v.allow {
+		root, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(root, real); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyUpload saves the uploaded parts under their sidecar names in a
+// temporary directory, hashing the archive on the way, and checks them.
+func (v *verifier) verifyUpload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, v.maxUpload)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "want multipart/form-data: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	dir, err := os.MkdirTemp("", "zipper-verify-")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// Sidecars may arrive before the archive, whose name they take.
+	parts := map[string]string{}
+	var archive, sum string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		field := part.FormName()
+		switch field {
+		case "archive", "sha256", "signature", "manifest":
+		default:
+			part.Close()
+			continue
+		}
+		f, err := os.CreateTemp(dir, field+"-")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h := sha256.New()
+		_, err = io.Copy(io.MultiWriter(f, h), part)
+		f.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		parts[field] = f.Name()
+		if field == "archive" {
+			archive = filepath.Base(part.FileName())
+			sum = hex.EncodeToString(h.Sum(nil))
+		}
+		if field == "signature" {
+			parts["signature-name"] = part.FileName()
+		}
+	}
+	if parts["archive"] == "" {
+		http.Error(w, "missing archive part", http.StatusBadRequest)
+		return
+	}
+	if archive == "" || archive == "." || archive == string(filepath.Separator) {
+		archive = "artifact.zip"
+	}
+
+	zipPath := filepath.Join(dir, archive)
+	// The signature's own name tells GPG (.asc, .sha256.sig) from raw.
+	sigName := zipPath + ".sig"
+	switch sn := parts["signature-name"]; {
+	case strings.HasSuffix(sn, ".asc"):
+		sigName = zipPath + ".sha256.asc"
+	case strings.HasSuffix(sn, ".sha256.sig"):
+		sigName = zipPath + ".sha256.sig"
+	}
+	names := map[string]string{
+		"archive":   zipPath,
+		"sha256":    zipPath + ".sha256",
+		"signature": sigName,
+		"manifest":  zipPath + ".manifest.json",
+	}
+	for field, name := range names {
+		if parts[field] == "" {
+			continue
+		}
+		if err := os.Rename(parts[field], name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writeVerifyResult(w, v.check(zipPath, sum))
+}
+
+// check compares the archive at zipPath, whose SHA256 is sum, with the
+// sidecars next to it: <zip>.sha256, a GPG signature of that
+// (<zip>.sha256.asc or .sha256.sig) or a raw one of the zip (<zip>.sig), and
+// <zip>.manifest.json.
+func (v *verifier) check(zipPath, sum string) verifyResult {
+	res := verifyResult{Artifact: filepath.Base(zipPath), Size: fileSize(zipPath), SHA256: sum}
+
+	if data, err := os.ReadFile(zipPath + ".sha256"); err == nil {
+		res.Checksum = checkSidecar(data, res.Artifact, sum)
+	}
+
+	for _, sig := range []string{zipPath + ".sha256.asc", zipPath + ".sha256.sig", zipPath + ".sig"} {
+		if _, err := os.Stat(sig); err != nil {
+			continue
+		}
+		res.Signature = v.checkSignature(sig, zipPath, sum)
+		break
+	}
+
+	if data, err := os.ReadFile(zipPath + ".manifest.json"); err == nil {
+		res.Manifest = checkManifest(data, res)
+	}
+
+	// With no sidecars at all nothing was checked, which isn't a pass.
+	ran := 0
+	res.OK = true
+	for _, c := range []*checkResult{res.Checksum, res.Signature, res.Manifest} {
+		if c != nil {
+			ran++
+			res.OK = res.OK && c.OK
+		}
+	}
+	if ran == 0 {
+		res.OK, res.Detail = false, "nothing to verify"
+	}
+	return res
+}
+
+// checkSidecar checks that a .sha256 sidecar (or signed copy of one) lists
+// artifact with sum.
+func checkSidecar(data []byte, artifact, sum string) *checkResult {
+	for _, line := range strings.Split(string(data), "\n") {
+		expected, name, ok := parseChecksumLine(strings.TrimRight(line, "\r"))
+		if !ok || filepath.Base(name) != artifact {
+			continue
+		}
+		if !strings.EqualFold(expected, sum) {
+			return &checkResult{Detail: "checksum mismatch: sidecar has " + strings.ToLower(expected)}
+		}
+		return &checkResult{OK: true}
+	}
+	return &checkResult{Detail: "no checksum for " + artifact}
+}
+
+func (v *verifier) checkSignature(sig, zipPath, sum string) *checkResult {
+	if strings.HasSuffix(sig, ".sha256.asc") || strings.HasSuffix(sig, ".sha256.sig") {
+		// GPG signs the .sha256 sidecar; the signed text must list this zip.
+		signed, fpr, err := gpgVerify(sig, zipPath+".sha256")
+		if err != nil {
+			return &checkResult{Detail: err.Error()}
+		}
+		if c := checkSidecar(signed, filepath.Base(zipPath), sum); !c.OK {
+			return &checkResult{Detail: "signed checksum doesn't match: " + c.Detail}
+		}
+		return &checkResult{OK: true, Detail: "gpg " + fpr}
+	}
+
+	if v.pub == nil {
+		return &checkResult{Detail: "raw signature, but the service has no -pubkey"}
+	}
+	raw, err := os.ReadFile(sig)
+	if err != nil {
+		return &checkResult{Detail: err.Error()}
+	}
+	digest, _ := hex.DecodeString(sum)
+	if err := verifyRaw(v.pub, digest, raw); err != nil {
+		return &checkResult{Detail: err.Error()}
+	}
+	return &checkResult{OK: true, Detail: "-pubkey"}
+}
+
+func checkManifest(data []byte, res verifyResult) *checkResult {
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return &checkResult{Detail: "invalid manifest: " + err.Error()}
+	}
+	var diffs []string
+	if m.Artifact != res.Artifact {
+		diffs = append(diffs, fmt.Sprintf("artifact %q, got %q", m.Artifact, res.Artifact))
+	}
+	if m.Size != res.Size {
+		diffs = append(diffs, fmt.Sprintf("size %d, got %d", m.Size, res.Size))
+	}
+	if m.SHA256 != "" && !strings.EqualFold(m.SHA256, res.SHA256) {
+		diffs = append(diffs, fmt.Sprintf("sha256 %s, got %s", m.SHA256, res.SHA256))
+	}
+	if len(diffs) > 0 {
+		return &checkResult{Detail: "manifest says " + strings.Join(diffs, "; ")}
+	}
+	return &checkResult{OK: true}
+}
+
+func writeVerifyResult(w http.ResponseWriter, res verifyResult) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(res)
+}
+
+// gpgVerify checks the gpg signature sig of file and returns the signed
+// content and the signing key's fingerprint. A .sig is a detached signature
+// of file; an .asc carries the content itself, as a signed message or
+// clearsigned text.
+func gpgVerify(sig, file string) ([]byte, string, error) {
+	args := []string{"--batch", "--status-fd", "2"}
+	if strings.HasSuffix(sig, ".sig") {
+		args = append(args, "--output", "-", "--verify", sig, file)
+	} else {
+		args = append(args, "--output", "-", "--decrypt", sig)
+	}
+	signed, status, err := runCommand(nil, "gpg", args...)
+	fpr := ""
+	for _, line := range strings.Split(string(status), "\n") {
+		if f := strings.Fields(line); len(f) >= 3 && f[0] == "[GNUPG:]" && f[1] == "VALIDSIG" {
+			fpr = f[2]
+		}
+	}
+	if fpr == "" {
+		return nil, "", fmt.Errorf("gpg: no valid signature from a trusted key (%v)", err)
+	}
+	if strings.HasSuffix(sig, ".sig") {
+		if signed, err = os.ReadFile(file); err != nil {
+			return nil, "", fmt.Errorf("detached signature without %s", filepath.Base(file))
+		}
+	}
+	return signed, fpr, nil
+}
+
+func loadPublicKey(file string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM public key", file)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// verifyRaw checks a KMS/PKCS#11 signature of digest: RSA PKCS#1 v1.5 or
+// PSS, or ECDSA.
+func verifyRaw(pub crypto.PublicKey, digest, sig []byte) error {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig) == nil || rsa.VerifyPSS(k, crypto.SHA256, digest, sig, nil) == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(k, digest, sig) {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported -pubkey type %T", pub)
+	}
+	return errors.New("signature doesn't match -pubkey")
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type signature struct {
+	File      string      `json:"file"`
+	Signer    string      `json:"signer"`
+	KeyID     string      `json:"key_id,omitempty"`
+	Algorithm string      `json:"algorithm,omitempty"`
+	Rekor     *rekorEntry `json:"rekor,omitempty"`
+}
+
+func validateSigner() error {
+	switch signerName {
+	case "gpg":
+		switch signFormat {
+		case "armor", "binary", "clearsign":
+			return nil
+		}
+		return fmt.Errorf("invalid -sign-format %q (want armor, binary or clearsign)", signFormat)
+	case "aws-kms", "azure-kv", "gcp-kms":
+		if signKey == "" {
+			return fmt.Errorf("-signer %s needs -sign-key", signerName)
+		}
+		return nil
+	case "pkcs11":
+		if signKey == "" || pkcs11Module == "" {
+			return fmt.Errorf("-signer pkcs11 needs -pkcs11-module and -sign-key")
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid -signer %q (want gpg, aws-kms, azure-kv, gcp-kms or pkcs11)", signerName)
+}
+
+// signatureFile is the sidecar produced by the configured signer. GPG signs
+// the .sha256 file; KMS and PKCS#11 signers sign the artifact digest, so their raw
+// signature verifies against the zip itself, e.g. with
+// "openssl dgst -sha256 -verify pub.pem -signature app.zip.sig app.zip".
+func signatureFile(zipPath string) string {
+	switch {
+	case signerName != "gpg":
+		return zipPath + ".sig"
+	case signFormat == "binary":
+		return zipPath + ".sha256.sig"
+	}
+	return zipPath + ".sha256.asc"
+}
+
+func signArtifact(zipPath, digest string) (signature, error) {
+	sig := signature{File: filepath.Base(signatureFile(zipPath)), Signer: signerName, KeyID: signKey}
+	if signerName == "gpg" {
+		if err := signWithGpg(zipPath + ".sha256"); err != nil {
+			return sig, err
+		}
+		if fpr, err := gpgSignatureFingerprint(zipPath); err == nil {
+			sig.KeyID = fpr
+		}
+		return sig, nil
+	}
+	return sig, signWithService(&sig, zipPath, digest, signatureFile(zipPath))
+}
+
+// signWithService signs file, whose SHA256 is digest, with the -signer key
+// service or token and writes the raw signature to out.
+func signWithService(sig *signature, file, digest, out string) error {
+	raw, err := hex.DecodeString(digest)
+	if err != nil {
+		return fmt.Errorf("invalid digest %q", digest)
+	}
+	var sigBytes []byte
+	switch signerName {
+	case "aws-kms":
+		sig.Algorithm = signAlgOr("RSASSA_PKCS1_V1_5_SHA_256")
+		sigBytes, sig.KeyID, err = signAWSKMS(raw, sig.Algorithm)
+	case "azure-kv":
+		sig.Algorithm = signAlgOr("RS256")
+		sigBytes, sig.KeyID, err = signAzureKeyVault(raw, sig.Algorithm)
+	case "gcp-kms":
+		sig.Algorithm = "SHA256"
+		sigBytes, err = signGCPKMS(file)
+	case "pkcs11":
+		sig.Algorithm = signAlgOr("RSA_PKCS1_SHA256")
+		sig.KeyID = fmt.Sprintf("slot %s: %s", pkcs11SlotOr("0"), signKey)
+		sigBytes, err = signPKCS11(raw, sig.Algorithm)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(out, sigBytes, 0644)
+}
+
+// gpgSignatureFingerprint returns the fingerprint of the key that made the
+// signature of zipPath's .sha256 file.
+func gpgSignatureFingerprint(zipPath string) (string, error) {
+	args := []string{"--status-fd", "1", "--verify", signatureFile(zipPath)}
+	if signFormat == "binary" {
+		args = append(args, zipPath+".sha256")
+	}
+	out, _, _ := runCommand(nil, "gpg", args...)
+	for _, line := range strings.Split(string(out), "\n") {
+		if f := strings.Fields(line); len(f) >= 3 && f[0] == "[GNUPG:]" && f[1] == "VALIDSIG" {
+			return f[2], nil
+		}
+	}
+	return "", fmt.Errorf("no valid signature found")
+}
+
+func signAlgOr(def string) string {
+	if signAlg != "" {
+		return signAlg
+	}
+	return def
+}
+
+func signAWSKMS(digest []byte, alg string) ([]byte, string, error) {
+	tmp, err := os.CreateTemp("", "zipper-digest-*")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.Remove(tmp.Name())
+	tmp.Write(digest)
+	tmp.Close()
+
+	out, err := runSignCLI("aws", "kms", "sign", "--key-id", signKey,
+		"--message", "fileb://"+tmp.Name(), "--message-type", "DIGEST",
+		"--signing-algorithm", alg, "--output", "json")
+	if err != nil {
+		return nil, "", err
+	}
+	var resp struct {
+		KeyId     string
+		Signature string
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, "", fmt.Errorf("unexpected aws kms output: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(resp.Signature)
+	return sig, resp.KeyId, err
+}
+
+func signAzureKeyVault(digest []byte, alg string) ([]byte, string, error) {
+	out, err := runSignCLI("az", "keyvault", "key", "sign", "--id", signKey,
+		"--algorithm", alg, "--digest", base64.StdEncoding.EncodeToString(digest), "--output", "json")
+	if err != nil {
+		return nil, "", err
+	}
+	var resp struct {
+		Kid       string `json:"kid"`
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, "", fmt.Errorf("unexpected az keyvault output: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(resp.Signature)
+	if err != nil {
+		sig, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(resp.Signature, "="))
+	}
+	return sig, resp.Kid, err
+}
+
+// signGCPKMS signs with a key version given as its full resource name,
+// projects/P/locations/L/keyRings/R/cryptoKeys/K/cryptoKeyVersions/V.
+func signGCPKMS(zipPath string) ([]byte, error) {
+	parts := strings.Split(signKey, "/")
+	if len(parts) != 10 || parts[0] != "projects" || parts[8] != "cryptoKeyVersions" {
+		return nil, fmt.Errorf("-sign-key for gcp-kms must be projects/P/locations/L/keyRings/R/cryptoKeys/K/cryptoKeyVersions/V")
+	}
+	tmp, err := os.CreateTemp("", "zipper-sig-*")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	_, err = runSignCLI("gcloud", "kms", "asymmetric-sign",
+		"--project", parts[1], "--location", parts[3], "--keyring", parts[5],
+		"--key", parts[7], "--version", parts[9], "--digest-algorithm", "sha256",
+		"--input-file", zipPath, "--signature-file", tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(tmp.Name())
+}
+
+func runSignCLI(name string, args ...string) ([]byte, error) {
+	out, stderr, err := runCommand(nil, name, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s sign failed: %s\n%s", name, err, stderr)
+	}
+	return out, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Off Windows, UNC targets (//server/share/path) are mounted with mount.cifs
+// for the copy and verify steps (Linux only, needs permission to mount).
+//
+// -auth picks the mechanism: kerberos uses the logon session on Windows (net
+// use gets no password) and sec=krb5 with the default ticket cache on Linux,
+// which -keytab fills for -user first; ntlm sends -user/-pass; negotiate, the
+// default, sends them too on Windows and tries Kerberos before NTLM on Linux.
+
+func validateAuth() error {
+	switch authMode {
+	case "negotiate", "kerberos":
+	case "ntlm":
+		if keytab != "" {
+			return fmt.Errorf("-keytab needs -auth kerberos or negotiate")
+		}
+		if runtime.GOOS == "windows" {
+			fmt.Fprintln(os.Stderr, "⚠️  -auth ntlm: Windows negotiates the mechanism for net use; NTLM is only used where Kerberos isn't available")
+		}
+	default:
+		return fmt.Errorf("invalid -auth %q: want ntlm, kerberos or negotiate", authMode)
+	}
+	if keytab != "" {
+		if runtime.GOOS == "windows" {
+			return fmt.Errorf("-keytab is not supported on Windows; the logon session's tickets are used")
+		}
+		authMode = "kerberos"
+	}
+	return nil
+}
+
+// qualifyUser prefixes user with domain (DOMAIN\user) unless it already names
+// one, either that way or as a UPN (user@corp.example.com).
+func qualifyUser(user, domain string) string {
+	if user == "" || domain == "" || strings.ContainsAny(user, `\@`) {
+		return user
+	}
+	return domain + `\` + user
+}
+
+// splitDomainUser splits DOMAIN\user; UPNs and plain names have no domain part.
+func splitDomainUser(user string) (string, string) {
+	if domain, name, ok := strings.Cut(user, `\`); ok {
+		return domain, name
+	}
+	return "", user
+}
+
+// kinitKeytab gets a ticket for user from -keytab into the default credential
+// cache. DOMAIN\user is turned into user@DOMAIN.
+func kinitKeytab(user string) error {
+	if user == "" {
+		return fmt.Errorf("-keytab needs -user (or a target credential) naming the principal")
+	}
+	principal := user
+	if domain, name := splitDomainUser(user); domain != "" {
+		principal = name + "@" + strings.ToUpper(domain)
+	}
+	cmd := exec.Command("kinit", "-k", "-t", keytab, principal)
+	if output, err := commandCombinedOutput(cmd); err != nil {
+		return fmt.Errorf("kinit failed: %s\n%s", err, output)
+	}
+	return nil
+}
+
+// mountSMB mounts the share of UNC path p on a temporary directory and
+// returns the directory and p's location inside it.
+func mountSMB(p, user, pass string) (string, string, error) {
+	if runtime.GOOS != "linux" {
+		return "", "", fmt.Errorf("UNC targets need Windows or Linux; mount the share and use its path instead")
+	}
+	parts := strings.FieldsFunc(p, func(r rune) bool { return r == '\\' || r == '/' })
+	if len(parts) < 2 {
+		return "", "", fmt.Errorf("invalid UNC path %q (want //server/share/path)", p)
+	}
+
+	var attempts [][]string
+	if authMode != "ntlm" {
+		if keytab != "" {
+			if err := kinitKeytab(user); err != nil {
+				return "", "", err
+			}
+		}
+		attempts = append(attempts, []string{"sec=krb5"})
+	}
+	if authMode != "kerberos" {
+		if user == "" {
+			attempts = append(attempts, []string{"guest"})
+		} else {
+			// A credentials file keeps the password off the mount command line.
+			f, err := os.CreateTemp("", "zipper-cifs-")
+			if err != nil {
+				return "", "", err
+			}
+			defer os.Remove(f.Name())
+			domain, name := splitDomainUser(user)
+			fmt.Fprintf(f, "username=%s\npassword=%s\n", name, pass)
+			if domain != "" {
+				fmt.Fprintf(f, "domain=%s\n", domain)
+			}
+			if err := f.Close(); err != nil {
+				return "", "", err
+			}
+			attempts = append(attempts, []string{"sec=ntlmssp", "credentials=" + f.Name()})
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "zipper-smb-")
+	if err != nil {
+		return "", "", err
+	}
+	share := "//" + parts[0] + "/" + parts[1]
+	var errs []string
+	for _, opts := range attempts {
+		cmd := exec.Command("mount", "-t", "cifs", share, dir, "-o", strings.Join(opts, ","))
+		output, err := commandCombinedOutput(cmd)
+		if err == nil {
+			return dir, filepath.Join(append([]string{dir}, parts[2:]...)...), nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s\n%s", opts[0], err, output))
+	}
+	os.Remove(dir)
+	return "", "", fmt.Errorf("mount failed: %s", strings.Join(errs, ""))
+}
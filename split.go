@@ -0,0 +1,146 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// artifact is one zip a run produces, with its sidecars. Normally there is a
+// single one of -src; -split-by-dir makes one per top-level directory and
+// -pack-into/-pack-max-size several of about the same size.
+type artifact struct {
+	src      string
+	zip      string
+	files    []sourceFile // nil to collect src when zipping
+	hash     string
+	manifest manifest
+	outputs  []string // the zip and the sidecars to copy
+}
+
+// planArtifacts decides which zips to make of src. With -split-by-dir, src is
+// walked once and each of its subdirectories goes into <out>-<dir>.zip, with
+// entries named as if that directory had been zipped on its own; files
+// directly in src are left out.
+func planArtifacts(src, out string) ([]artifact, error) {
+	if !splitByDir && packInto == 0 && packMaxSize == 0 {
+		return []artifact{{src: src, zip: out}}, nil
+	}
+	if dryRun {
+		fmt.Printf("[DRYRUN] Would list %s to plan the archives\n", src)
+	}
+	files, err := collectSource(src)
+	if err != nil {
+		return nil, err
+	}
+	if !splitByDir {
+		return packArtifacts(src, out, files), nil
+	}
+	ext := filepath.Ext(out)
+	stem := strings.TrimSuffix(out, ext)
+	var artifacts []artifact
+	index := map[string]int{}
+	loose := 0
+	for _, f := range files {
+		rel, _ := filepath.Rel(src, f.path)
+		dir, _, ok := strings.Cut(rel, string(filepath.Separator))
+		if !ok {
+			loose++
+			continue
+		}
+		i, seen := index[dir]
+		if !seen {
+			i = len(artifacts)
+			index[dir] = i
+			artifacts = append(artifacts, artifact{src: filepath.Join(src, dir), zip: stem + "-" + dir + ext})
+		}
+		f.name = rel
+		artifacts[i].files = append(artifacts[i].files, f)
+	}
+	if loose > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️  -split-by-dir: %d files directly in %s are not archived\n", loose, src)
+	}
+	if len(artifacts) == 0 {
+		return nil, fmt.Errorf("-split-by-dir: %s has no subdirectories with files", src)
+	}
+	return artifacts, nil
+}
+
+func validatePacking() error {
+	switch {
+	case packInto < 0:
+		return fmt.Errorf("invalid -pack-into %d", packInto)
+	case packInto > 0 && packMaxSize > 0:
+		return fmt.Errorf("use -pack-into or -pack-max-size, not both")
+	case splitByDir && (packInto > 0 || packMaxSize > 0):
+		return fmt.Errorf("-split-by-dir can't be combined with -pack-into or -pack-max-size")
+	}
+	return nil
+}
+
+// packArtifacts spreads files over -pack-into zips, or as many as it takes to
+// keep each under -pack-max-size, balancing their uncompressed sizes. Largest
+// files are placed first, each in the emptiest zip (or the first one it fits
+// in), and every zip keeps the source order and full entry names, so
+// extracting them all rebuilds the tree.
+func packArtifacts(src, out string, files []sourceFile) []artifact {
+	bySize := slices.Clone(files)
+	slices.SortStableFunc(bySize, func(a, b sourceFile) int { return cmp.Compare(b.size, a.size) })
+
+	var bins [][]sourceFile
+	var sizes []int64
+	if packInto > 0 {
+		bins = make([][]sourceFile, packInto)
+		sizes = make([]int64, packInto)
+	}
+	for _, f := range bySize {
+		i := -1
+		if packInto > 0 {
+			i = 0
+			for j := range sizes {
+				if sizes[j] < sizes[i] {
+					i = j
+				}
+			}
+		} else {
+			for j := range sizes {
+				if sizes[j]+f.size <= int64(packMaxSize) {
+					i = j
+					break
+				}
+			}
+			if i < 0 {
+				if f.size > int64(packMaxSize) {
+					fmt.Fprintf(os.Stderr, "⚠️  %s (%s) is larger than -pack-max-size and gets a zip of its own\n", f.name, formatSize(f.size))
+				}
+				i = len(bins)
+				bins = append(bins, nil)
+				sizes = append(sizes, 0)
+			}
+		}
+		bins[i] = append(bins[i], f)
+		sizes[i] += f.size
+	}
+
+	ext := filepath.Ext(out)
+	stem := strings.TrimSuffix(out, ext)
+	var artifacts []artifact
+	for _, bin := range bins {
+		if len(bin) == 0 {
+			continue
+		}
+		slices.SortFunc(bin, func(a, b sourceFile) int { return walkCompare(a.name, b.name) })
+		artifacts = append(artifacts, artifact{src: src, files: bin})
+	}
+	for i := range artifacts {
+		artifacts[i].zip = fmt.Sprintf("%s-part%d-of-%d%s", stem, i+1, len(artifacts), ext)
+	}
+	if len(artifacts) == 0 {
+		// An empty source still makes one (empty) zip.
+		artifacts = append(artifacts, artifact{src: src, zip: out, files: []sourceFile{}})
+	}
+	return artifacts
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SSH targets are sftp://[user@]host[:port]/path and scp://[user@]host[:port]/path,
+// copied with the OpenSSH sftp and scp commands. Authentication is by key
+// (-ssh-key or the agent); there are no password prompts. Host keys are
+// always checked: against known_hosts (-ssh-known-hosts to use another file),
+// against a pinned -ssh-host-key fingerprint, or, with -ssh-tofu, by adding
+// an unknown host's key on first use and checking it from then on.
+
+func isSSH(p string) bool {
+	return strings.HasPrefix(p, "sftp://") || strings.HasPrefix(p, "scp://")
+}
+
+type sshTarget struct {
+	scheme, user, host, port, dir string
+}
+
+func parseSSHTarget(p string) (sshTarget, error) {
+	u, err := url.Parse(p)
+	if err != nil || u.Hostname() == "" {
+		return sshTarget{}, fmt.Errorf("invalid SSH target %q (want sftp://user@host/path)", p)
+	}
+	t := sshTarget{scheme: u.Scheme, user: u.User.Username(), host: u.Hostname(), port: u.Port(), dir: u.Path}
+	if t.port == "" {
+		t.port = "22"
+	}
+	if t.dir == "" {
+		t.dir = "."
+	}
+	return t, nil
+}
+
+// sshWithUser adds user (e.g. from a target credential) to an SSH target
+// that doesn't name one.
+func sshWithUser(p, user string) string {
+	u, err := url.Parse(p)
+	if err != nil || user == "" || u.User != nil {
+		return p
+	}
+	u.User = url.User(user)
+	return u.String()
+}
+
+func (t sshTarget) login() string {
+	if t.user == "" {
+		return t.host
+	}
+	return t.user + "@" + t.host
+}
+
+// sshOptions returns the ssh -o options enforcing the host key policy, and a
+// cleanup for any temporary known_hosts file.
+func sshOptions(t sshTarget) ([]string, func(), error) {
+	opts := []string{"-o", "BatchMode=yes"}
+	if sshKey != "" {
+		opts = append(opts, "-i", sshKey, "-o", "IdentitiesOnly=yes")
+	}
+	if sshHostKey != "" {
+		known, err := pinnedKnownHosts(t)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, "-o", "StrictHostKeyChecking=yes", "-o", "UserKnownHostsFile="+known)
+		return opts, func() { os.Remove(known) }, nil
+	}
+	if sshKnownHosts != "" {
+		opts = append(opts, "-o", "UserKnownHostsFile="+sshKnownHosts)
+	}
+	if sshTOFU {
+		opts = append(opts, "-o", "StrictHostKeyChecking=accept-new")
+	} else {
+		opts = append(opts, "-o", "StrictHostKeyChecking=yes")
+	}
+	return opts, func() {}, nil
+}
+
+// pinnedKnownHosts scans the host's keys and writes those matching
+// -ssh-host-key to a temporary known_hosts file. ssh then checks the server
+// actually holds the key, so the scan itself needn't be trusted.
+func pinnedKnownHosts(t sshTarget) (string, error) {
+	out, err := commandOutput(exec.Command("ssh-keyscan", "-p", t.port, t.host))
+	if err != nil {
+		return "", fmt.Errorf("ssh-keyscan %s failed: %s", t.host, err)
+	}
+	var matched []string
+	var seen []string
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		fp, err := sshFingerprint(fields[2])
+		if err != nil {
+			continue
+		}
+		seen = append(seen, fields[1]+" "+fp)
+		if fp == sshHostKey || strings.TrimPrefix(fp, "SHA256:") == sshHostKey {
+			matched = append(matched, line)
+		}
+	}
+	if len(matched) == 0 {
+		return "", fmt.Errorf("host key for %s doesn't match -ssh-host-key %s; the server offered:\n%s",
+			t.host, sshHostKey, strings.Join(seen, "\n"))
+	}
+	f, err := os.CreateTemp("", "zipper-known-hosts-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, err = f.WriteString(strings.Join(matched, "\n") + "\n")
+	return f.Name(), err
+}
+
+// sshFingerprint formats a base64 public key blob the way ssh-keygen -l does.
+func sshFingerprint(blob string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(blob)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(key)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
+
+// sftpQuote quotes an argument for an sftp batch command.
+func sftpQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// runSFTP runs batch commands against t, aborting on the first failure.
+func runSFTP(t sshTarget, opts []string, commands []string) (string, error) {
+	args := append([]string{"-b", "-", "-P", t.port}, opts...)
+	cmd := exec.Command("sftp", append(args, t.login())...)
+	cmd.Stdin = strings.NewReader(strings.Join(commands, "\n") + "\n")
+	output, err := commandCombinedOutput(cmd)
+	if err != nil {
+		return "", fmt.Errorf("sftp failed: %s\n%s", err, output)
+	}
+	return string(output), nil
+}
+
+// copyToSSH copies files to an sftp:// or scp:// target. -file-mode is
+// applied on sftp targets.
+func copyToSSH(dest string, files []string, dryRun bool) error {
+	if dryRun {
+		for _, file := range files {
+			remote := strings.TrimRight(dest, "/") + "/" + filepath.Base(file)
+			fmt.Printf("[DRYRUN] Would copy %s → %s\n", file, remote)
+			if fileMode != 0 && strings.HasPrefix(dest, "sftp://") {
+				fmt.Printf("[DRYRUN] Would chmod %04o %s\n", fileMode, remote)
+			}
+		}
+		return nil
+	}
+	t, err := parseSSHTarget(dest)
+	if err != nil {
+		return err
+	}
+	opts, cleanup, err := sshOptions(t)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	var total int64
+	for _, file := range files {
+		total += fileSize(file)
+	}
+	prog := startProgress("copy", total)
+	defer prog.finish()
+
+	for _, file := range files {
+		remote := path.Join(t.dir, filepath.Base(file))
+		prog.setFile(filepath.Base(file))
+		err := withRetry("copy "+file, func() error {
+			if t.scheme == "scp" {
+				args := append([]string{"-B", "-P", t.port}, opts...)
+				args = append(args, file, t.login()+":"+remote)
+				if output, err := commandCombinedOutput(exec.Command("scp", args...)); err != nil {
+					return fmt.Errorf("scp failed: %s\n%s", err, output)
+				}
+				return nil
+			}
+			commands := []string{"put " + sftpQuote(file) + " " + sftpQuote(remote)}
+			if fileMode != 0 {
+				commands = append(commands, fmt.Sprintf("chmod %o %s", fileMode, sftpQuote(remote)))
+			}
+			_, err := runSFTP(t, opts, commands)
+			return err
+		})
+		if err != nil {
+			ghaError(file, err)
+			return err
+		}
+		prog.add(fileSize(file))
+	}
+	return nil
+}
+
+// sshStat returns the size of name on an SSH target. sftp's listing has no
+// usable modification time, so that is left zero.
+func sshStat(dest, name string) (int64, time.Time, error) {
+	t, err := parseSSHTarget(dest)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	opts, cleanup, err := sshOptions(t)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer cleanup()
+	out, err := runSFTP(t, opts, []string{"ls -ln " + sftpQuote(path.Join(t.dir, name))})
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		// -rw-r--r--    1 1000     1000      1234 Oct 16 10:00 /srv/releases/app.zip
+		fields := strings.Fields(line)
+		if len(fields) >= 9 && strings.HasPrefix(fields[0], "-") {
+			size, err := strconv.ParseInt(fields[4], 10, 64)
+			return size, time.Time{}, err
+		}
+	}
+	return 0, time.Time{}, fmt.Errorf("sftp: unexpected listing for %s:\n%s", name, out)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// -status-socket serves the state of the running job on a unix socket, or a
+// named pipe (\\.\pipe\name) on Windows. Each connection gets one JSON
+// document and is closed, so a GUI polls by connecting again.
+
+type jobStatus struct {
+	PID     int            `json:"pid"`
+	Started time.Time      `json:"started"`
+	Target  string         `json:"target,omitempty"`
+	Current *progressEvent `json:"current,omitempty"`
+	Stages  []stageTiming  `json:"stages"`
+}
+
+var (
+	statusMu      sync.Mutex
+	statusOn      bool
+	statusStarted time.Time
+	statusCurrent *progressEvent
+)
+
+// startStatus listens on addr and serves status to clients until exit.
+func startStatus(addr string) error {
+	statusStarted = time.Now().UTC()
+	if err := listenStatus(addr); err != nil {
+		return err
+	}
+	statusOn = true
+	return nil
+}
+
+// publishStatus records ev as the running stage's latest state.
+func publishStatus(ev progressEvent) {
+	if !statusOn {
+		return
+	}
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	if ev.Event == "done" {
+		statusCurrent = nil
+		return
+	}
+	statusCurrent = &ev
+}
+
+func statusJSON() []byte {
+	st := jobStatus{PID: os.Getpid(), Started: statusStarted, Stages: timings()}
+	timingMu.Lock()
+	st.Target = timingTarget
+	timingMu.Unlock()
+	statusMu.Lock()
+	st.Current = statusCurrent
+	statusMu.Unlock()
+	if st.Stages == nil {
+		st.Stages = []stageTiming{}
+	}
+	b, _ := json.Marshal(st)
+	return append(b, '\n')
+}
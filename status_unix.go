@@ -0,0 +1,34 @@
+//go:build !windows
+
+package main
+
+import (
+	"net"
+	"os"
+)
+
+func listenStatus(addr string) error {
+	// A socket left behind by an earlier run would make Listen fail.
+	if info, err := os.Lstat(addr); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(addr)
+	}
+	l, err := net.Listen("unix", addr)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(addr, 0600); err != nil {
+		l.Close()
+		return err
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write(statusJSON())
+			conn.Close()
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+const statusPipeMode = windows.PIPE_TYPE_BYTE | windows.PIPE_WAIT | windows.PIPE_REJECT_REMOTE_CLIENTS
+
+// listenStatus creates the named pipe addr (\\.\pipe\name). The first
+// instance is created here, so a pipe already owned by another process is an
+// error rather than a silent second server.
+func listenStatus(addr string) error {
+	name, err := windows.UTF16PtrFromString(addr)
+	if err != nil {
+		return err
+	}
+	h, err := windows.CreateNamedPipe(name, windows.PIPE_ACCESS_OUTBOUND|windows.FILE_FLAG_FIRST_PIPE_INSTANCE,
+		statusPipeMode, windows.PIPE_UNLIMITED_INSTANCES, 4096, 0, 0, nil)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			err := windows.ConnectNamedPipe(h, nil)
+			if err == nil || err == windows.ERROR_PIPE_CONNECTED {
+				var n uint32
+				windows.WriteFile(h, statusJSON(), &n, nil)
+				windows.FlushFileBuffers(h)
+				windows.DisconnectNamedPipe(h)
+			}
+			windows.CloseHandle(h)
+			if h, err = windows.CreateNamedPipe(name, windows.PIPE_ACCESS_OUTBOUND,
+				statusPipeMode, windows.PIPE_UNLIMITED_INSTANCES, 4096, 0, 0, nil); err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
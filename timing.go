@@ -0,0 +1,59 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// stageTiming is how long one stage took and how much it processed, so a
+// slow run can be told apart as CPU, disk or network bound.
+type stageTiming struct {
+	Stage   string  `json:"stage"`
+	Target  string  `json:"target,omitempty"`
+	Seconds float64 `json:"seconds"`
+	Bytes   int64   `json:"bytes,omitempty"`
+	Files   int     `json:"files,omitempty"`
+}
+
+// Rate formats the stage's throughput, or "-" when it has no byte count.
+func (t stageTiming) Rate() string {
+	if t.Bytes == 0 || t.Seconds == 0 {
+		return "-"
+	}
+	return formatSize(int64(float64(t.Bytes)/t.Seconds)) + "/s"
+}
+
+var (
+	timingMu     sync.Mutex
+	stageTimings []stageTiming
+	timingTarget string // the target the copy and verify stages are for
+)
+
+// recordStage adds a stage that started at start and is ending now.
+func recordStage(stage string, start time.Time, bytes int64, files int) {
+	recordStageDuration(stage, time.Since(start), bytes, files)
+}
+
+func recordStageDuration(stage string, d time.Duration, bytes int64, files int) {
+	timingMu.Lock()
+	defer timingMu.Unlock()
+	stageTimings = append(stageTimings, stageTiming{
+		Stage:   stage,
+		Target:  timingTarget,
+		Seconds: d.Round(time.Millisecond).Seconds(),
+		Bytes:   bytes,
+		Files:   files,
+	})
+}
+
+func setTimingTarget(t string) {
+	timingMu.Lock()
+	defer timingMu.Unlock()
+	timingTarget = t
+}
+
+func timings() []stageTiming {
+	timingMu.Lock()
+	defer timingMu.Unlock()
+	return append([]stageTiming(nil), stageTimings...)
+}
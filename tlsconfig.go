@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// setupTLS applies -tls-cert/-tls-key (a client certificate presented to
+// servers that ask for one) and -tls-ca (extra trusted CAs, added to the
+// system pool) to httpClient.
+func setupTLS() error {
+	if tlsCert == "" && tlsKey == "" && tlsCA == "" {
+		return nil
+	}
+	cfg, err := tlsConfig()
+	if err != nil {
+		return err
+	}
+	transport().TLSClientConfig = cfg
+	return nil
+}
+
+func tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if (tlsCert == "") != (tlsKey == "") {
+		return nil, fmt.Errorf("-tls-cert and -tls-key go together")
+	}
+	if tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if tlsCA != "" {
+		pool, err := loadCAPool(tlsCA, true)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// loadCAPool returns the PEM certificates in file, added to the system roots
+// when system is set.
+func loadCAPool(file string, system bool) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if system {
+		if sys, err := x509.SystemCertPool(); err == nil {
+			pool = sys
+		}
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no PEM certificates found", file)
+	}
+	return pool, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// writeTorrent writes a single-file BitTorrent v1 metainfo file for zipPath,
+// with -torrent-tracker announce URLs and -torrent-webseed HTTP seeds
+// (BEP 19; a URL ending in "/" gets the file name appended by clients).
+// It returns the hex info hash.
+func writeTorrent(zipPath string) (string, error) {
+	size := fileSize(zipPath)
+	pieceLen := int64(torrentPieceSize)
+	if pieceLen == 0 {
+		pieceLen = autoPieceSize(size)
+	}
+
+	f, err := os.Open(zipPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	prog := startProgress("torrent", size)
+	defer prog.finish()
+	prog.setFile(filepath.Base(zipPath))
+
+	var pieces bytes.Buffer
+	buf := make([]byte, pieceLen)
+	for {
+		n, err := io.ReadFull(io.TeeReader(f, prog), buf)
+		if n > 0 {
+			sum := sha1.Sum(buf[:n])
+			pieces.Write(sum[:])
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	info := map[string]any{
+		"name":         filepath.Base(zipPath),
+		"length":       size,
+		"piece length": pieceLen,
+		"pieces":       pieces.String(),
+	}
+	meta := map[string]any{
+		"created by":    "zipper",
+		"creation date": time.Now().Unix(),
+		"info":          info,
+	}
+	if len(torrentTrackers) > 0 {
+		meta["announce"] = torrentTrackers[0]
+		var tiers []any
+		for _, t := range torrentTrackers {
+			tiers = append(tiers, []any{t})
+		}
+		meta["announce-list"] = tiers
+	}
+	if len(torrentWebSeeds) > 0 {
+		var seeds []any
+		for _, s := range torrentWebSeeds {
+			seeds = append(seeds, s)
+		}
+		meta["url-list"] = seeds
+	}
+
+	var out, infoOut bytes.Buffer
+	if err := bencode(&out, meta); err != nil {
+		return "", err
+	}
+	if err := bencode(&infoOut, info); err != nil {
+		return "", err
+	}
+	infoHash := sha1.Sum(infoOut.Bytes())
+	return hex.EncodeToString(infoHash[:]), os.WriteFile(zipPath+".torrent", out.Bytes(), 0644)
+}
+
+// autoPieceSize picks a power of two between 256 KiB and 16 MiB giving
+// roughly 1000-2000 pieces.
+func autoPieceSize(size int64) int64 {
+	p := int64(256 << 10)
+	for p < 16<<20 && size/p > 2000 {
+		p *= 2
+	}
+	return p
+}
+
+func bencode(w *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case string:
+		fmt.Fprintf(w, "%d:%s", len(v), v)
+	case int64:
+		fmt.Fprintf(w, "i%de", v)
+	case []any:
+		w.WriteByte('l')
+		for _, e := range v {
+			if err := bencode(w, e); err != nil {
+				return err
+			}
+		}
+		w.WriteByte('e')
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		// Dictionary keys must be sorted as raw byte strings.
+		sort.Strings(keys)
+		w.WriteByte('d')
+		for _, k := range keys {
+			bencode(w, k)
+			if err := bencode(w, v[k]); err != nil {
+				return err
+			}
+		}
+		w.WriteByte('e')
+	default:
+		return fmt.Errorf("bencode: unsupported type %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var vaultToken string
+
+// vaultRead resolves a "vault:<path>#<field>" reference, e.g.
+// vault:secret/data/zipper/deploy#password. Both KV v1 and v2 responses are
+// understood. The server comes from VAULT_ADDR (and VAULT_NAMESPACE).
+func vaultRead(ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || field == "" {
+		return "", fmt.Errorf("vault: reference %q has no #field", ref)
+	}
+	token, err := vaultLogin()
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := vaultRequest(http.MethodGet, "/v1/"+strings.TrimPrefix(path, "/"), token, nil, &resp); err != nil {
+		return "", err
+	}
+	data := resp.Data
+	if inner, ok := data["data"].(map[string]any); ok && data["metadata"] != nil {
+		data = inner
+	}
+	v, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault: %s has no string field %q", path, field)
+	}
+	return v, nil
+}
+
+// vaultLogin returns VAULT_TOKEN, logs in with AppRole when VAULT_ROLE_ID and
+// VAULT_SECRET_ID are set, or falls back to ~/.vault-token.
+func vaultLogin() (string, error) {
+	if vaultToken != "" {
+		return vaultToken, nil
+	}
+	if t := os.Getenv("VAULT_TOKEN"); t != "" {
+		vaultToken = t
+		return t, nil
+	}
+	if roleID := os.Getenv("VAULT_ROLE_ID"); roleID != "" {
+		mount := os.Getenv("VAULT_APPROLE_MOUNT")
+		if mount == "" {
+			mount = "approle"
+		}
+		body := map[string]string{"role_id": roleID, "secret_id": os.Getenv("VAULT_SECRET_ID")}
+		var resp struct {
+			Auth struct {
+				ClientToken string `json:"client_token"`
+			} `json:"auth"`
+		}
+		if err := vaultRequest(http.MethodPost, "/v1/auth/"+mount+"/login", "", body, &resp); err != nil {
+			return "", fmt.Errorf("vault approle login: %w", err)
+		}
+		vaultToken = resp.Auth.ClientToken
+		return vaultToken, nil
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if t, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+			vaultToken = strings.TrimSpace(string(t))
+			return vaultToken, nil
+		}
+	}
+	return "", fmt.Errorf("vault: no VAULT_TOKEN, VAULT_ROLE_ID or ~/.vault-token")
+}
+
+func vaultRequest(method, path, token string, body, out any) error {
+	addr := strings.TrimRight(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return fmt.Errorf("vault: VAULT_ADDR is not set")
+	}
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, addr+path, r)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("vault: %s %s: %s\n%s", method, path, resp.Status, msg)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mtimeSlack absorbs timestamp rounding on FAT and some SMB servers.
+const mtimeSlack = 2 * time.Second
+
+func validateVerifyMode() error {
+	switch verifyMode {
+	case "full", "quick":
+		return nil
+	}
+	return fmt.Errorf("invalid -verify-mode %q (want full or quick)", verifyMode)
+}
+
+// verifyQuick checks that the copy of localFile on dest has the same size
+// and, where the target reports one, isn't older than the local file. It
+// doesn't read the remote content.
+func verifyQuick(dest, localFile, secret string) error {
+	info, err := os.Stat(localFile)
+	if err != nil {
+		return err
+	}
+	size, mtime, err := remoteStat(dest, filepath.Base(localFile), secret)
+	if err != nil {
+		return err
+	}
+	if size != info.Size() {
+		return fmt.Errorf("size mismatch:\nExpected: %d\nActual:   %d", info.Size(), size)
+	}
+	if !mtime.IsZero() && mtime.Add(mtimeSlack).Before(info.ModTime()) {
+		return fmt.Errorf("remote file is older than the local artifact (%s < %s)",
+			mtime.Format(time.RFC3339), info.ModTime().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// remoteStat returns the size and modification time (zero if unknown) of
+// name on dest.
+func remoteStat(dest, name, secret string) (int64, time.Time, error) {
+	switch {
+	case strings.HasPrefix(dest, "s3://"):
+		bucket, prefix := splitBucket(dest)
+		out, err := runAWS("s3api", "head-object", "--bucket", bucket, "--key", path.Join(prefix, name))
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		var resp struct {
+			ContentLength int64
+			LastModified  string
+		}
+		if err := json.Unmarshal(out, &resp); err != nil {
+			return 0, time.Time{}, fmt.Errorf("aws head-object: unexpected output:\n%s", out)
+		}
+		mtime, _ := time.Parse(time.RFC3339, resp.LastModified)
+		return resp.ContentLength, mtime, nil
+
+	case strings.HasPrefix(dest, "gs://"):
+		bucket, prefix := splitBucket(dest)
+		token, err := googleToken(secret, scopeStorage)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/storage/v1/b/%s/o/%s",
+			gcsEndpoint(), url.PathEscape(bucket), url.PathEscape(path.Join(prefix, name))), nil)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		var obj struct {
+			Size    string    `json:"size"`
+			Updated time.Time `json:"updated"`
+		}
+		if err := doJSON(req, &obj); err != nil {
+			return 0, time.Time{}, fmt.Errorf("gcs: %w", err)
+		}
+		size, err := strconv.ParseInt(obj.Size, 10, 64)
+		return size, obj.Updated, err
+
+	case strings.HasPrefix(dest, "gdrive://"):
+		return driveStat(dest, name, secret)
+
+	case isDropbox(dest):
+		meta, err := dropboxStat(dest, name, secret)
+		return meta.Size, meta.ServerModified, err
+
+	case isGraph(dest):
+		return graphStat(dest, name, secret)
+
+	case isSSH(dest):
+		return sshStat(dest, name)
+
+	case isAzureBlob(dest):
+		u, err := url.Parse(dest)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		if secret != "" {
+			u.RawQuery = strings.TrimPrefix(secret, "?")
+		}
+		u.Path = path.Join("/", u.Path, name)
+		req, err := http.NewRequest(http.MethodHead, u.String(), nil)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		req.Header.Set("x-ms-version", azureVersion)
+		resp, err := httpClient.Do(req)
+		if ue, ok := err.(*url.Error); ok {
+			err = ue.Err
+		}
+		if err != nil {
+			return 0, time.Time{}, fmt.Errorf("azure: %w", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return 0, time.Time{}, fmt.Errorf("azure: %s", resp.Status)
+		}
+		mtime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return resp.ContentLength, mtime, nil
+	}
+
+	info, err := os.Stat(filepath.Join(dest, name))
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return info.Size(), info.ModTime(), nil
+}
+
+func doJSON(req *http.Request, v any) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s\n%s", resp.Status, msg)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// -verify-source re-reads source files once the zip is written and checks
+// they still hash to what went into it, catching disk or network corruption
+// (and files changed mid-run) that would otherwise be archived silently.
+
+// hashingFiles reports whether archived files are hashed as they are read.
+func hashingFiles() bool {
+	return fileHashes || writeChain || verifySource != ""
+}
+
+func validateVerifySource() error {
+	_, err := verifySampleSize(verifySource, 0)
+	return err
+}
+
+// verifySampleSize returns how many of n files -verify-source spec asks for:
+// "all", a share like "10%" or a count.
+func verifySampleSize(spec string, n int) (int, error) {
+	switch {
+	case spec == "":
+		return 0, nil
+	case spec == "all":
+		return n, nil
+	case strings.HasSuffix(spec, "%"):
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(spec, "%"), 64)
+		if err != nil || pct <= 0 || pct > 100 {
+			break
+		}
+		// At least one file, so a small tree isn't left unchecked.
+		return min(n, max(1, int(float64(n)*pct/100))), nil
+	default:
+		count, err := strconv.Atoi(spec)
+		if err != nil || count <= 0 {
+			break
+		}
+		return min(n, count), nil
+	}
+	return 0, fmt.Errorf("invalid -verify-source %q (want all, a share like 10%% or a number of files)", spec)
+}
+
+// verifySourceFiles re-hashes a random sample of files and compares them with
+// hashes, the SHA256 of each as it was archived.
+func verifySourceFiles(files []sourceFile, hashes []string) error {
+	n, err := verifySampleSize(verifySource, len(files))
+	if err != nil {
+		return err
+	}
+	sample := rand.Perm(len(files))[:n]
+	// Read in archive order, which is directory order on disk.
+	slices.Sort(sample)
+	var total int64
+	for _, i := range sample {
+		total += files[i].size
+	}
+
+	prog := startProgress("verify-source", total)
+	defer prog.finish()
+	var changed []string
+	for _, i := range sample {
+		prog.setFile(files[i].name)
+		sum, err := fileSHA256(files[i].path, prog)
+		if err != nil {
+			return fmt.Errorf("cannot re-read source: %w", err)
+		}
+		if dropCache {
+			dropPageCache(files[i].path)
+		}
+		if sum != hashes[i] {
+			changed = append(changed, files[i].path)
+		}
+	}
+	prog.finish()
+	if len(changed) > 0 {
+		for _, p := range changed {
+			ghaError(p, fmt.Errorf("source file changed or corrupted after archiving"))
+		}
+		if len(changed) > 10 {
+			changed = append(changed[:10], fmt.Sprintf("... and %d more", len(changed)-10))
+		}
+		return fmt.Errorf("source files don't match what was archived:\n%s", strings.Join(changed, "\n"))
+	}
+	fmt.Printf("✅ Source verified: %d of %d files re-hashed\n", n, len(files))
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Time spent matching exclude rules, summed over walkers, and the number of
+// paths they excluded, for the filter stage timing.
+var filterNanos, filterExcluded atomic.Int64
+
+// excludedPath is a path skipped by an exclude rule, kept for -list-excluded.
+// Excluded directories aren't descended into, so their contents aren't listed.
+type excludedPath struct {
+	name string
+	rule string
+}
+
+var (
+	excludedMu    sync.Mutex
+	excludedPaths []excludedPath
+)
+
+// collectFiles lists the files under src, skipping excluded paths.
+// Directories are read by -walk-workers goroutines, since listing huge trees
+// on network shares and SSDs is latency-bound; the result is sorted into
+// filepath.Walk order so it doesn't depend on scheduling.
+func collectFiles(src string) ([]sourceFile, error) {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Dir(src)
+	if !info.IsDir() {
+		name, _ := filepath.Rel(base, src)
+		return []sourceFile{{path: src, name: name, size: info.Size(), first: firstRank(filepath.Base(src))}}, nil
+	}
+
+	var (
+		mu      sync.Mutex
+		cond    = sync.NewCond(&mu)
+		queue   = []string{src}
+		busy    int
+		files   []sourceFile
+		walkErr error
+	)
+	worker := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for {
+			for len(queue) == 0 && busy > 0 && walkErr == nil {
+				cond.Wait()
+			}
+			if len(queue) == 0 || walkErr != nil {
+				cond.Broadcast()
+				return
+			}
+			// Taking the newest directory keeps the queue about as long as
+			// the tree is deep rather than wide.
+			dir := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			busy++
+			mu.Unlock()
+			found, subdirs, err := readSourceDir(src, base, dir)
+			mu.Lock()
+			busy--
+			if err != nil && walkErr == nil {
+				walkErr = err
+			}
+			files = append(files, found...)
+			queue = append(queue, subdirs...)
+			cond.Broadcast()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(walkWorkers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker()
+		}()
+	}
+	wg.Wait()
+	if walkErr != nil {
+		return nil, walkErr
+	}
+	slices.SortFunc(files, func(a, b sourceFile) int { return walkCompare(a.name, b.name) })
+	return files, nil
+}
+
+// readSourceDir returns the files and the subdirectories to descend into in
+// dir. Like filepath.Walk, entries are Lstat'ed, so symlinks aren't followed
+// into directories. Listing is retried, as it's what fails first on a flaky
+// share.
+func readSourceDir(src, base, dir string) ([]sourceFile, []string, error) {
+	var entries []os.DirEntry
+	err := withRetry("list "+dir, func() error {
+		f, err := os.Open(dir)
+		if err != nil {
+			return err
+		}
+		entries, err = f.ReadDir(-1)
+		f.Close()
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	var files []sourceFile
+	var subdirs []string
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		rel, _ := filepath.Rel(src, path)
+		start := time.Now()
+		rule, excluded := excludedBy(filepath.ToSlash(rel))
+		filterNanos.Add(int64(time.Since(start)))
+		if excluded {
+			filterExcluded.Add(1)
+			if listExcluded != "" {
+				name, _ := filepath.Rel(base, path)
+				if e.IsDir() {
+					name += string(filepath.Separator)
+				}
+				excludedMu.Lock()
+				excludedPaths = append(excludedPaths, excludedPath{name: name, rule: rule})
+				excludedMu.Unlock()
+			}
+			continue
+		}
+		if e.IsDir() {
+			subdirs = append(subdirs, path)
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, nil, err
+		}
+		name, _ := filepath.Rel(base, path)
+		files = append(files, sourceFile{path: path, name: name, size: info.Size(), first: firstRank(filepath.ToSlash(rel))})
+	}
+	return files, subdirs, nil
+}
+
+// walkCompare orders paths the way filepath.Walk visits them: by name within
+// each directory, so "a/b" comes before "a.txt".
+func walkCompare(a, b string) int {
+	sep := string(filepath.Separator)
+	for {
+		ha, ra, moreA := strings.Cut(a, sep)
+		hb, rb, moreB := strings.Cut(b, sep)
+		if ha != hb || !moreA || !moreB {
+			if c := strings.Compare(ha, hb); c != 0 {
+				return c
+			}
+			// A file and a directory can't share a name; this only keeps
+			// the order total.
+			return strings.Compare(a, b)
+		}
+		a, b = ra, rb
+	}
+}
+
+// writeExcludedList writes the excluded paths, in walk order, one per line
+// with the rule that matched: "path<TAB>rule". Directories end in a separator.
+func writeExcludedList(file string) error {
+	slices.SortFunc(excludedPaths, func(a, b excludedPath) int {
+		return walkCompare(strings.TrimSuffix(a.name, string(filepath.Separator)), strings.TrimSuffix(b.name, string(filepath.Separator)))
+	})
+	var b strings.Builder
+	for _, p := range excludedPaths {
+		b.WriteString(p.name + "\t" + p.rule + "\n")
+	}
+	return os.WriteFile(file, []byte(b.String()), 0o644)
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+import "errors"
+
+var errNoXattrs = errors.New("extended attributes are not supported on this platform")
+
+func readFileMeta(path string) (fileMeta, error) {
+	return fileMeta{}, errNoXattrs
+}
+
+func writeFileMeta(path string, m fileMeta) []error {
+	return []error{errNoXattrs}
+}
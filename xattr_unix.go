@@ -0,0 +1,58 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+func readFileMeta(path string) (fileMeta, error) {
+	var m fileMeta
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil || size == 0 {
+		if err == unix.ENOTSUP {
+			err = nil
+		}
+		return m, err
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Llistxattr(path, buf); err != nil {
+		return m, err
+	}
+	for _, name := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		n, err := unix.Lgetxattr(path, name, nil)
+		if err != nil {
+			return m, fmt.Errorf("%s: %w", name, err)
+		}
+		value := make([]byte, n)
+		if n, err = unix.Lgetxattr(path, name, value); err != nil {
+			return m, fmt.Errorf("%s: %w", name, err)
+		}
+		if m.Xattrs == nil {
+			m.Xattrs = map[string][]byte{}
+		}
+		m.Xattrs[name] = value[:n]
+	}
+	return m, nil
+}
+
+// writeFileMeta sets m's attributes on path; Windows streams become user.
+// attributes.
+func writeFileMeta(path string, m fileMeta) []error {
+	var errs []error
+	set := func(name string, value []byte) {
+		if err := unix.Lsetxattr(path, name, value, 0); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	for name, value := range m.Xattrs {
+		set(name, value)
+	}
+	for name, value := range m.Streams {
+		set("user."+name, value)
+	}
+	return errs
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modkernel32          = windows.NewLazySystemDLL("kernel32.dll")
+	procFindFirstStreamW = modkernel32.NewProc("FindFirstStreamW")
+	procFindNextStreamW  = modkernel32.NewProc("FindNextStreamW")
+)
+
+// findStreamData mirrors WIN32_FIND_STREAM_DATA.
+type findStreamData struct {
+	StreamSize int64
+	StreamName [windows.MAX_PATH + 36]uint16
+}
+
+// readFileMeta reads the named $DATA streams of path, such as the
+// Zone.Identifier Windows adds to downloads.
+func readFileMeta(path string) (fileMeta, error) {
+	var m fileMeta
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return m, err
+	}
+	var data findStreamData
+	h, _, err := procFindFirstStreamW.Call(uintptr(unsafe.Pointer(p)), 0, uintptr(unsafe.Pointer(&data)), 0)
+	if windows.Handle(h) == windows.InvalidHandle {
+		if err == windows.ERROR_HANDLE_EOF {
+			return m, nil
+		}
+		return m, err
+	}
+	defer windows.FindClose(windows.Handle(h))
+	for {
+		// Names look like ":Zone.Identifier:$DATA"; "::$DATA" is the file itself.
+		name := windows.UTF16ToString(data.StreamName[:])
+		if s, ok := strings.CutSuffix(strings.TrimPrefix(name, ":"), ":$DATA"); ok && s != "" {
+			value, err := os.ReadFile(path + ":" + s)
+			if err != nil {
+				return m, err
+			}
+			if m.Streams == nil {
+				m.Streams = map[string][]byte{}
+			}
+			m.Streams[s] = value
+		}
+		r, _, err := procFindNextStreamW.Call(h, uintptr(unsafe.Pointer(&data)))
+		if r == 0 {
+			if err == windows.ERROR_HANDLE_EOF {
+				return m, nil
+			}
+			return m, err
+		}
+	}
+}
+
+// writeFileMeta writes m's streams to path. Of the attributes from other
+// platforms, only user. ones have an equivalent: a stream without the prefix.
+func writeFileMeta(path string, m fileMeta) []error {
+	var errs []error
+	set := func(name string, value []byte) {
+		if err := os.WriteFile(path+":"+name, value, 0644); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for name, value := range m.Streams {
+		set(name, value)
+	}
+	for name, value := range m.Xattrs {
+		if s, ok := strings.CutPrefix(name, "user."); ok {
+			set(s, value)
+		} else {
+			errs = append(errs, fmt.Errorf("%s: no Windows equivalent", name))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// WinZip AES entries (AE-1 and AE-2, as written by 7-Zip and WinZip) have
+// method 99, with the real method and the key strength in extra field
+// 0x9901. Their data is a salt, a 2-byte password verifier, the AES-CTR
+// encrypted compressed data and a 10-byte HMAC-SHA1 of that, with the keys
+// derived from the password by PBKDF2-HMAC-SHA1.
+const (
+	methodWinZipAES = 99
+	winzipAESExtra  = 0x9901
+	winzipMACLen    = 10
+)
+
+// winzipKeyLen returns the AES key length named by an entry's 0x9901 field.
+func winzipKeyLen(extra []byte) (int, bool) {
+	for len(extra) >= 4 {
+		tag := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			break
+		}
+		if tag == winzipAESExtra && size >= 7 {
+			switch extra[4+4] {
+			case 1:
+				return 16, true
+			case 2:
+				return 24, true
+			case 3:
+				return 32, true
+			}
+		}
+		extra = extra[4+size:]
+	}
+	return 0, false
+}
+
+type winzipKeys struct {
+	block    cipher.Block
+	macKey   []byte
+	verifier []byte
+}
+
+func deriveWinzipKeys(pass string, salt []byte, keyLen int) (winzipKeys, error) {
+	k, err := pbkdf2.Key(sha1.New, pass, salt, 1000, 2*keyLen+2)
+	if err != nil {
+		return winzipKeys{}, err
+	}
+	block, err := aes.NewCipher(k[:keyLen])
+	if err != nil {
+		return winzipKeys{}, err
+	}
+	return winzipKeys{block: block, macKey: k[keyLen : 2*keyLen], verifier: k[2*keyLen:]}, nil
+}
+
+// winzipCTR is AES-CTR with WinZip's little-endian counter, starting at 1.
+type winzipCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	used    int
+}
+
+func newWinzipCTR(block cipher.Block) *winzipCTR {
+	return &winzipCTR{block: block, used: aes.BlockSize}
+}
+
+func (c *winzipCTR) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.used == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.used = 0
+		}
+		dst[i] = src[i] ^ c.stream[c.used]
+		c.used++
+	}
+}
+
+// reencryptZip copies the zip in to out with each WinZip AES entry decrypted
+// with oldPass and encrypted again with newPass, under a fresh salt and the
+// same key strength. The compressed data itself is not touched, so nothing
+// is recompressed. Unencrypted entries are copied as they are.
+func reencryptZip(in string, out io.Writer, oldPass, newPass string, prog *stageProgress) error {
+	r, err := zip.OpenReader(in)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	zw := zip.NewWriter(out)
+	var encrypted int
+	buf := make([]byte, 32*1024)
+	for _, f := range r.File {
+		fh := f.FileHeader
+		// Keep the DOS time and extra fields as they are; a set Modified
+		// would add a second timestamp field.
+		fh.Modified = time.Time{}
+		raw, err := f.OpenRaw()
+		if err != nil {
+			return err
+		}
+		w, err := zw.CreateRaw(&fh)
+		if err != nil {
+			return err
+		}
+		prog.setFile(f.Name)
+		if f.Method != methodWinZipAES {
+			if f.Flags&0x1 != 0 {
+				return fmt.Errorf("%s: ZipCrypto encryption is not supported, only WinZip AES", f.Name)
+			}
+			if _, err := io.CopyBuffer(w, io.TeeReader(raw, prog), buf); err != nil {
+				return err
+			}
+			continue
+		}
+
+		keyLen, ok := winzipKeyLen(f.Extra)
+		saltLen := uint64(keyLen / 2)
+		if !ok || f.CompressedSize64 < saltLen+2+winzipMACLen {
+			return fmt.Errorf("%s: malformed WinZip AES entry", f.Name)
+		}
+		head := make([]byte, saltLen+2)
+		if _, err := io.ReadFull(raw, head); err != nil {
+			return err
+		}
+		old, err := deriveWinzipKeys(oldPass, head[:saltLen], keyLen)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(old.verifier, head[saltLen:]) {
+			return fmt.Errorf("%s: wrong -pass", f.Name)
+		}
+		salt := make([]byte, saltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		next, err := deriveWinzipKeys(newPass, salt, keyLen)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(salt, next.verifier...)); err != nil {
+			return err
+		}
+
+		oldMAC, nextMAC := hmac.New(sha1.New, old.macKey), hmac.New(sha1.New, next.macKey)
+		dec, enc := newWinzipCTR(old.block), newWinzipCTR(next.block)
+		data := io.LimitReader(raw, int64(f.CompressedSize64-saltLen-2-winzipMACLen))
+		for {
+			n, err := data.Read(buf)
+			if n > 0 {
+				b := buf[:n]
+				oldMAC.Write(b)
+				dec.XORKeyStream(b, b)
+				enc.XORKeyStream(b, b)
+				nextMAC.Write(b)
+				if _, err := w.Write(b); err != nil {
+					return err
+				}
+				prog.add(int64(n))
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		mac := make([]byte, winzipMACLen)
+		if _, err := io.ReadFull(raw, mac); err != nil {
+			return err
+		}
+		if !hmac.Equal(mac, oldMAC.Sum(nil)[:winzipMACLen]) {
+			return fmt.Errorf("%s: authentication code mismatch; the entry is corrupt", f.Name)
+		}
+		if _, err := w.Write(nextMAC.Sum(nil)[:winzipMACLen]); err != nil {
+			return err
+		}
+		encrypted++
+	}
+	if encrypted == 0 {
+		return fmt.Errorf("%s has no WinZip AES encrypted entries", in)
+	}
+	if err := zw.SetComment(r.Comment); err != nil {
+		return err
+	}
+	return zw.Close()
+}